@@ -9,6 +9,7 @@ import (
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/metrics"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/workload"
 )
 
 const ErrNoMessagesFmt = "No messages found for experiment %d in algorithm %s"
@@ -31,9 +32,48 @@ type AnalyzeResults struct {
 	OKCount             int
 	CorruptedCount      int
 	LostCount           int
+	UndetectedCorrupted int
+	DetectedCorruptions int
 	AliveNodesCount     int
 	DeadNodesCount      int
 	TimerExpired        bool
+	PartitionDrops      int
+	PostHealConvergence time.Duration
+	AvgQueueingDelay    time.Duration
+	MaxQueueingDelay    time.Duration
+	DuplicateCount      int
+	ReorderCount        int
+	CrashCount          int
+	RecoverCount        int
+	ChurnedNodes        int     // узлы, отказавшие хотя бы раз
+	AliveCoverage       float64 // доля узлов, живых в конце, у которых есть сообщение
+	ByzantineNodes      int
+	PoisonedCount       int // честные узлы, принявшие подделку
+	ByzantineDrops      int
+	LeakedGoroutines    int // горутины, не завершившиеся после остановки кластера
+	KeyUpdates          int // записи ключей, включая начальные
+	KeysConverged       int // записи, дошедшие до всех живых узлов
+	AvgKeyConvergence   time.Duration
+	MaxKeyConvergence   time.Duration
+	CausalityViolations int // получения, записанные по часам раньше своей отправки
+	CaughtUpCount       int // восстановления, после которых узел снова получил сообщение
+	NotCaughtUpCount    int // узлы, не догнавшие остальных к концу симуляции
+	AvgCatchUpTime      time.Duration
+	MaxCatchUpTime      time.Duration
+	Retransmissions     int               // повторные отправки надёжного транспорта
+	AckMessages         int               // отправленные подтверждения
+	GaveUpCount         int               // сообщения, так и не подтверждённые
+	WireBytes           int64             // байты, записанные в сокеты (-transport udp|tcp)
+	AvgEncodeTime       time.Duration     // среднее время кодирования сообщения
+	AvgDecodeTime       time.Duration     // среднее время декодирования сообщения
+	InboxDrops          int               // сообщения, отброшенные из-за переполненной очереди
+	OverloadedNodes     int               // узлы, отбросившие хотя бы одно сообщение
+	MembershipMessages  int               // сообщения протокола частичных представлений
+	AvgViewSize         float64           // средний размер представления живых узлов в конце
+	MaxViewInDegree     int               // наибольшее число представлений, в которых есть один узел
+	AvgPeerDistance     float64           // среднее расстояние до выбранных Gossip пиров в мс пространства координат
+	HealTime            time.Time         // момент восстановления сети после последнего разделения (не пишется в БД)
+	Updates             []workload.Update // записи ключей за симуляцию (не пишутся в БД)
 }
 
 func Analyze(nodes []*node.Node, algo string) {
@@ -56,11 +96,22 @@ func Analyze(nodes []*node.Node, algo string) {
 	createAnalyzeResults(nodes, db, algo)
 
 	writeToDB(db)
+
+	if len(keyResults) > 0 {
+		createKeysTable(db)
+		writeKeysToDB(db, algo, keyResults)
+	}
+	if loadConfigured() {
+		createLoadTable(db)
+		writeLoadToDB(db, algo, loadResults)
+	}
 }
 
 func createAnalyzeResults(nodes []*node.Node, db *sql.DB, algo string) {
 
 	var err error
+	keyResults = nil
+	loadResults = nil
 	Summary.ExperimentID = flags.Exper.ID
 	Summary.Algorithm = algo
 	Summary.Time, err = getTimeDuration(db, flags.Exper.ID, algo)
@@ -72,11 +123,32 @@ func createAnalyzeResults(nodes []*node.Node, db *sql.DB, algo string) {
 	Summary.TotalMessages = getTotalMessages(db, flags.Exper.ID, algo)
 	Summary.MaxSentFromNode = getMaxSentFromNode(db, flags.Exper.ID, algo)
 	Summary.MaxReceivedByNode = getMaxReceivedByNode(db, flags.Exper.ID, algo)
+	Summary.DuplicateCount = getEventCount(db, flags.Exper.ID, algo, "Duplicate")
+	Summary.ReorderCount = getEventCount(db, flags.Exper.ID, algo, "Reorder")
+	Summary.CrashCount = getEventCount(db, flags.Exper.ID, algo, "Crash")
+	Summary.RecoverCount = getEventCount(db, flags.Exper.ID, algo, "Recover")
+	Summary.ChurnedNodes = getChurnedNodes(db, flags.Exper.ID, algo)
+	Summary.CausalityViolations = getCausalityViolations(db, flags.Exper.ID, algo)
+	Summary.Retransmissions = getEventCount(db, flags.Exper.ID, algo, "Retransmit")
+	Summary.AckMessages = getEventCount(db, flags.Exper.ID, algo, "Ack")
+	Summary.GaveUpCount = getEventCount(db, flags.Exper.ID, algo, "GiveUp")
 	getDB(nodes) //Get OK, Corrupted and Lost count from nodes
 	getAliveAndDeadNodesCount(nodes)
+	getAliveCoverage(nodes)
+	getCatchUps(nodes)
+	loadResults = getNodeLoad(nodes)
 
 	getPercentages()
-
+	keyResults = getKeyConvergence(nodes, Summary.Updates)
+	summarizeKeys(keyResults)
+
+	Summary.PostHealConvergence = 0
+	if !Summary.HealTime.IsZero() {
+		Summary.PostHealConvergence, err = getPostHealConvergence(db, flags.Exper.ID, algo, Summary.HealTime)
+		if err != nil {
+			log.Printf("Error getting convergence after heal: %v", err)
+		}
+	}
 }
 
 func createTable(db *sql.DB) {
@@ -99,13 +171,89 @@ func createTable(db *sql.DB) {
     LostCount                  INTEGER,
     AliveNodesCount            INTEGER,
     DeadNodesCount             INTEGER,
-	TimerExpired			   BOOLEAN 
+	TimerExpired			   BOOLEAN,
+    PartitionDrops             INTEGER,
+    PostHealConvergence        REAL,
+    AvgQueueingDelay           REAL,
+    MaxQueueingDelay           REAL,
+    DuplicateCount             INTEGER,
+    ReorderCount               INTEGER,
+    UndetectedCorrupted        INTEGER,
+    DetectedCorruptions        INTEGER,
+    CrashCount                 INTEGER,
+    RecoverCount               INTEGER,
+    ChurnedNodes               INTEGER,
+    AliveCoverage              REAL,
+    ByzantineNodes             INTEGER,
+    PoisonedCount              INTEGER,
+    ByzantineDrops             INTEGER,
+    LeakedGoroutines           INTEGER,
+    KeyUpdates                 INTEGER,
+    KeysConverged              INTEGER,
+    AvgKeyConvergence          REAL,
+    MaxKeyConvergence          REAL,
+    CausalityViolations        INTEGER,
+    CaughtUpCount              INTEGER,
+    NotCaughtUpCount           INTEGER,
+    AvgCatchUpTime             REAL,
+    MaxCatchUpTime             REAL,
+    Retransmissions            INTEGER,
+    AckMessages                INTEGER,
+    GaveUpCount                INTEGER,
+    WireBytes                  INTEGER,
+    AvgEncodeTime              REAL,
+    AvgDecodeTime              REAL,
+    InboxDrops                 INTEGER,
+    OverloadedNodes            INTEGER,
+    MembershipMessages         INTEGER,
+    AvgViewSize                REAL,
+    MaxViewInDegree            INTEGER,
+    AvgPeerDistance            REAL
 );`
 
 	_, err := db.Exec(sqlStmt)
 	if err != nil {
 		log.Fatal(err)
 	}
+	metrics.AddMissingColumns(db, tableName, []metrics.Column{
+		{Name: "PartitionDrops", Type: "INTEGER"},
+		{Name: "PostHealConvergence", Type: "REAL"},
+		{Name: "AvgQueueingDelay", Type: "REAL"},
+		{Name: "MaxQueueingDelay", Type: "REAL"},
+		{Name: "DuplicateCount", Type: "INTEGER"},
+		{Name: "ReorderCount", Type: "INTEGER"},
+		{Name: "UndetectedCorrupted", Type: "INTEGER"},
+		{Name: "DetectedCorruptions", Type: "INTEGER"},
+		{Name: "CrashCount", Type: "INTEGER"},
+		{Name: "RecoverCount", Type: "INTEGER"},
+		{Name: "ChurnedNodes", Type: "INTEGER"},
+		{Name: "AliveCoverage", Type: "REAL"},
+		{Name: "ByzantineNodes", Type: "INTEGER"},
+		{Name: "PoisonedCount", Type: "INTEGER"},
+		{Name: "ByzantineDrops", Type: "INTEGER"},
+		{Name: "LeakedGoroutines", Type: "INTEGER"},
+		{Name: "KeyUpdates", Type: "INTEGER"},
+		{Name: "KeysConverged", Type: "INTEGER"},
+		{Name: "AvgKeyConvergence", Type: "REAL"},
+		{Name: "MaxKeyConvergence", Type: "REAL"},
+		{Name: "CausalityViolations", Type: "INTEGER"},
+		{Name: "CaughtUpCount", Type: "INTEGER"},
+		{Name: "NotCaughtUpCount", Type: "INTEGER"},
+		{Name: "AvgCatchUpTime", Type: "REAL"},
+		{Name: "MaxCatchUpTime", Type: "REAL"},
+		{Name: "Retransmissions", Type: "INTEGER"},
+		{Name: "AckMessages", Type: "INTEGER"},
+		{Name: "GaveUpCount", Type: "INTEGER"},
+		{Name: "WireBytes", Type: "INTEGER"},
+		{Name: "AvgEncodeTime", Type: "REAL"},
+		{Name: "AvgDecodeTime", Type: "REAL"},
+		{Name: "InboxDrops", Type: "INTEGER"},
+		{Name: "OverloadedNodes", Type: "INTEGER"},
+		{Name: "MembershipMessages", Type: "INTEGER"},
+		{Name: "AvgViewSize", Type: "REAL"},
+		{Name: "MaxViewInDegree", Type: "INTEGER"},
+		{Name: "AvgPeerDistance", Type: "REAL"},
+	})
 	flags.VPrintln("Table", tableName, "created successfully")
 }
 
@@ -117,8 +265,23 @@ func writeToDB(db *sql.DB) error {
 		MaxSentFromNode, MaxReceivedByNode,
 		OKPercentage, CorruptedPercentage, LostPercentage,
 		OKCount, CorruptedCount, LostCount,
-		AliveNodesCount, DeadNodesCount, TimerExpired
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		AliveNodesCount, DeadNodesCount, TimerExpired,
+		PartitionDrops, PostHealConvergence,
+		AvgQueueingDelay, MaxQueueingDelay,
+		DuplicateCount, ReorderCount,
+		UndetectedCorrupted, DetectedCorruptions,
+		CrashCount, RecoverCount, ChurnedNodes, AliveCoverage,
+		ByzantineNodes, PoisonedCount, ByzantineDrops,
+		LeakedGoroutines,
+		KeyUpdates, KeysConverged, AvgKeyConvergence, MaxKeyConvergence,
+		CausalityViolations,
+		CaughtUpCount, NotCaughtUpCount, AvgCatchUpTime, MaxCatchUpTime,
+		Retransmissions, AckMessages, GaveUpCount,
+		WireBytes, AvgEncodeTime, AvgDecodeTime,
+		InboxDrops, OverloadedNodes,
+		MembershipMessages, AvgViewSize, MaxViewInDegree,
+		AvgPeerDistance
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := db.Exec(query,
@@ -138,6 +301,43 @@ func writeToDB(db *sql.DB) error {
 		Summary.AliveNodesCount,
 		Summary.DeadNodesCount,
 		Summary.TimerExpired,
+		Summary.PartitionDrops,
+		Summary.PostHealConvergence,
+		Summary.AvgQueueingDelay,
+		Summary.MaxQueueingDelay,
+		Summary.DuplicateCount,
+		Summary.ReorderCount,
+		Summary.UndetectedCorrupted,
+		Summary.DetectedCorruptions,
+		Summary.CrashCount,
+		Summary.RecoverCount,
+		Summary.ChurnedNodes,
+		Summary.AliveCoverage,
+		Summary.ByzantineNodes,
+		Summary.PoisonedCount,
+		Summary.ByzantineDrops,
+		Summary.LeakedGoroutines,
+		Summary.KeyUpdates,
+		Summary.KeysConverged,
+		Summary.AvgKeyConvergence,
+		Summary.MaxKeyConvergence,
+		Summary.CausalityViolations,
+		Summary.CaughtUpCount,
+		Summary.NotCaughtUpCount,
+		Summary.AvgCatchUpTime,
+		Summary.MaxCatchUpTime,
+		Summary.Retransmissions,
+		Summary.AckMessages,
+		Summary.GaveUpCount,
+		Summary.WireBytes,
+		Summary.AvgEncodeTime,
+		Summary.AvgDecodeTime,
+		Summary.InboxDrops,
+		Summary.OverloadedNodes,
+		Summary.MembershipMessages,
+		Summary.AvgViewSize,
+		Summary.MaxViewInDegree,
+		Summary.AvgPeerDistance,
 	)
 
 	if err != nil {
@@ -177,6 +377,41 @@ func getTimeDuration(db *sql.DB, experimentID int, algo string) (time.Duration,
 	return maxTime.Sub(minTime), nil
 }
 
+// getPostHealConvergence returns how long after the partition healed the last
+// alive node received the message for the first time (0 if it converged earlier).
+func getPostHealConvergence(db *sql.DB, experimentID int, algo string, healTime time.Time) (time.Duration, error) {
+	var lastStr sql.NullString
+
+	query := `
+		SELECT MAX(first) FROM (
+			SELECT MIN(Time) AS first
+			FROM ` + algo + `
+			WHERE ExperimentID = ? AND MessageType = 'Receive' AND AliveNode = 'true'
+				AND MessagesData = 'OK'
+			GROUP BY NodeID
+		);
+	`
+
+	err := db.QueryRow(query, experimentID).Scan(&lastStr)
+	if err != nil {
+		return 0, fmt.Errorf("query failed: %w", err)
+	}
+	if !lastStr.Valid {
+		return 0, nil // никто не получил сообщение
+	}
+
+	const layout = "2006-01-02 15:04:05.999999999"
+	last, err := time.ParseInLocation(layout, lastStr.String, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse time: %w", err)
+	}
+
+	if last.Before(healTime) {
+		return 0, nil
+	}
+	return last.Sub(healTime), nil
+}
+
 func getRoundsCount(algo string) int {
 
 	switch algo {
@@ -185,6 +420,9 @@ func getRoundsCount(algo string) int {
 	case "Singlecast":
 		return 1
 	case "Multicast":
+		if flags.Exper.TreeDepth > 0 || flags.Exper.TreeBranching > 0 {
+			return Summary.Rounds // высота k-арного дерева
+		}
 		return flags.Exper.MulticastDomains
 	default:
 		// For Gossip, information is send during simulation
@@ -259,19 +497,98 @@ func getMaxReceivedByNode(db *sql.DB, experimentID int, algo string) int {
 	return MaxReceivedByNode
 }
 
+// getEventCount counts event log rows of the given message type.
+func getEventCount(db *sql.DB, experimentID int, algo string, messageType string) int {
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM ` + algo + `
+		WHERE MessageType = ? and ExperimentID = ?;
+	`
+
+	err := db.QueryRow(query, messageType, experimentID).Scan(&count)
+	if err != nil {
+		log.Printf("Error counting %s events: %v", messageType, err)
+		return 0
+	}
+	return count
+}
+
+// getChurnedNodes counts the nodes that crashed at least once during the run.
+func getChurnedNodes(db *sql.DB, experimentID int, algo string) int {
+	var count int
+	query := `
+		SELECT COUNT(DISTINCT NodeID)
+		FROM ` + algo + `
+		WHERE MessageType = 'Crash' and ExperimentID = ?;
+	`
+
+	err := db.QueryRow(query, experimentID).Scan(&count)
+	if err != nil {
+		log.Printf("Error counting churned nodes: %v", err)
+		return 0
+	}
+	return count
+}
+
+// getCausalityViolations counts receive events whose wall-clock time is earlier
+// than the time of their send event. A receive is matched to its send by the
+// Lamport stamp the message carries. Events of one node are logged in order,
+// so every happened-before relation is a chain of such send-receive pairs and
+// these are the only places where wall-clock order can contradict it.
+func getCausalityViolations(db *sql.DB, experimentID int, algo string) int {
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM ` + algo + ` r
+		JOIN ` + algo + ` s
+			ON s.ExperimentID = r.ExperimentID AND s.MessageType = 'Send'
+			AND s.NodeID = r.SenderID AND s.Lamport = r.MsgLamport
+		WHERE r.ExperimentID = ? AND r.MessageType = 'Receive' AND r.MsgLamport > 0
+			AND r.Time < s.Time;
+	`
+
+	err := db.QueryRow(query, experimentID).Scan(&count)
+	if err != nil {
+		log.Printf("Error counting causality violations: %v", err)
+		return 0
+	}
+	return count
+}
+
+// getDB classifies the final state of every node: OK if it holds an intact
+// message, corrupted if it holds a payload damaged without detection, a
+// forgery, or has only seen copies rejected by the checksum, lost otherwise.
 func getDB(nodes []*node.Node) {
 	Summary.OKCount = 0
 	Summary.CorruptedCount = 0
 	Summary.LostCount = 0
-	for _, msg := range nodes {
-		switch msg.DB.Data {
-		case "OK":
+	Summary.UndetectedCorrupted = 0
+	Summary.DetectedCorruptions = 0
+	Summary.ByzantineNodes = 0
+	Summary.PoisonedCount = 0
+	Summary.ByzantineDrops = 0
+	for _, n := range nodes {
+		Summary.DetectedCorruptions += n.CorruptedRejected
+		Summary.ByzantineDrops += n.ByzantineDrops
+		if n.Byzantine() {
+			Summary.ByzantineNodes++
+		}
+		db := n.Stored()
+		switch {
+		case db.Data == "OK" && db.Forged:
+			Summary.CorruptedCount++
+			if !n.Byzantine() {
+				Summary.PoisonedCount++
+			}
+		case db.Data == "OK" && !db.Corrupted:
 			Summary.OKCount++
-		case "corrupted":
+		case db.Data == "OK" && db.Corrupted:
+			Summary.CorruptedCount++
+			Summary.UndetectedCorrupted++
+		case n.CorruptedRejected > 0:
 			Summary.CorruptedCount++
-		case "lost":
-			Summary.LostCount++
-		case "":
+		default:
 			Summary.LostCount++ // If no data, consider it lost
 		}
 	}
@@ -289,6 +606,45 @@ func getAliveAndDeadNodesCount(nodes []*node.Node) {
 	}
 }
 
+// getAliveCoverage computes the share of nodes alive at the end of the run that
+// hold an intact message. Under churn this is the coverage that matters:
+// nodes that are down cannot be expected to have it.
+func getAliveCoverage(nodes []*node.Node) {
+	Summary.AliveCoverage = 0
+	informed := 0
+	for _, n := range nodes {
+		if db := n.Stored(); n.Alive && db.Data == "OK" && !db.Corrupted && !db.Forged {
+			informed++
+		}
+	}
+	if Summary.AliveNodesCount > 0 {
+		Summary.AliveCoverage = float64(informed) / float64(Summary.AliveNodesCount) * 100
+	}
+}
+
+// getCatchUps summarizes how long recovered nodes took to hold the message
+// again. Nodes that are up at the end but still without it count as not caught up.
+func getCatchUps(nodes []*node.Node) {
+	Summary.CaughtUpCount = 0
+	Summary.NotCaughtUpCount = 0
+	Summary.AvgCatchUpTime = 0
+	Summary.MaxCatchUpTime = 0
+	var total time.Duration
+	for _, n := range nodes {
+		for _, d := range n.CatchUps {
+			Summary.CaughtUpCount++
+			total += d
+			Summary.MaxCatchUpTime = max(Summary.MaxCatchUpTime, d)
+		}
+		if n.Alive && n.CatchingUp() {
+			Summary.NotCaughtUpCount++
+		}
+	}
+	if Summary.CaughtUpCount > 0 {
+		Summary.AvgCatchUpTime = total / time.Duration(Summary.CaughtUpCount)
+	}
+}
+
 func getPercentages() {
 	Summary.OKPercentage = float64(Summary.OKCount) / float64(flags.Exper.NodeCount) * 100
 	Summary.CorruptedPercentage = float64(Summary.CorruptedCount) / float64(flags.Exper.NodeCount) * 100
@@ -0,0 +1,163 @@
+package analyze
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/workload"
+)
+
+var keysTableName = "KeyConvergence"
+
+var keyResults []KeyConvergence // записи ключей последней симуляции
+
+// KeyConvergence is the fate of one key update: how many of the nodes alive
+// at the end hold it (or a newer version) and how long the last one waited.
+type KeyConvergence struct {
+	Key          string
+	Version      int
+	Origin       int
+	IssuedAt     time.Duration // от начала симуляции
+	NodesReached int
+	AliveNodes   int
+	Converged    bool
+	Convergence  time.Duration // от записи до её появления на последнем живом узле
+}
+
+// getKeyConvergence measures every update issued during the run against the
+// history of the node stores. A node counts as reached from the moment it
+// stored the update or any version that supersedes it after its last crash
+// that emptied the store; what it stored before that crash is lost.
+func getKeyConvergence(nodes []*node.Node, updates []workload.Update) []KeyConvergence {
+	if len(updates) == 0 {
+		return nil
+	}
+	start := updates[0].At // корень записывает ключи в начале симуляции
+
+	var alive [][]node.Applied
+	for _, n := range nodes {
+		if n.Alive {
+			alive = append(alive, n.Store.History())
+		}
+	}
+
+	results := make([]KeyConvergence, 0, len(updates))
+	for _, u := range updates {
+		kc := KeyConvergence{
+			Key:        u.Entry.Key,
+			Version:    u.Entry.Version,
+			Origin:     u.Entry.Origin,
+			IssuedAt:   u.At.Sub(start),
+			AliveNodes: len(alive),
+		}
+		var last time.Time
+		for _, history := range alive {
+			for _, a := range sinceLastWipe(history) {
+				if a.Entry.Key != u.Entry.Key || u.Entry.Newer(a.Entry) {
+					continue
+				}
+				kc.NodesReached++
+				if a.Time.After(last) {
+					last = a.Time
+				}
+				break
+			}
+		}
+		kc.Converged = kc.AliveNodes > 0 && kc.NodesReached == kc.AliveNodes
+		if kc.Converged && last.After(u.At) {
+			kc.Convergence = last.Sub(u.At)
+		}
+		results = append(results, kc)
+	}
+	return results
+}
+
+// sinceLastWipe returns the part of a store history after the last crash that
+// emptied the store.
+func sinceLastWipe(history []node.Applied) []node.Applied {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Wiped {
+			return history[i+1:]
+		}
+	}
+	return history
+}
+
+// summarizeKeys fills the key columns of the summary.
+func summarizeKeys(results []KeyConvergence) {
+	Summary.KeyUpdates = len(results)
+	Summary.KeysConverged = 0
+	Summary.AvgKeyConvergence = 0
+	Summary.MaxKeyConvergence = 0
+	var total time.Duration
+	for _, kc := range results {
+		if !kc.Converged {
+			continue
+		}
+		Summary.KeysConverged++
+		total += kc.Convergence
+		Summary.MaxKeyConvergence = max(Summary.MaxKeyConvergence, kc.Convergence)
+	}
+	if Summary.KeysConverged > 0 {
+		Summary.AvgKeyConvergence = total / time.Duration(Summary.KeysConverged)
+	}
+}
+
+func createKeysTable(db *sql.DB) {
+	sqlStmt := `
+	CREATE TABLE IF NOT EXISTS ` + keysTableName + ` (
+	ID					       INTEGER PRIMARY KEY AUTOINCREMENT,
+    ExperimentID               INTEGER,
+	Algorithm                  TEXT,
+    Key                        TEXT,
+    Version                    INTEGER,
+    Origin                     INTEGER,
+    IssuedAt                   REAL,
+    NodesReached               INTEGER,
+    AliveNodes                 INTEGER,
+    Converged                  BOOLEAN,
+    ConvergenceTime            REAL
+);`
+
+	_, err := db.Exec(sqlStmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	flags.VPrintln("Table", keysTableName, "created successfully")
+}
+
+func writeKeysToDB(db *sql.DB, algo string, results []KeyConvergence) error {
+	query := `
+	INSERT INTO ` + keysTableName + ` (
+		ExperimentID, Algorithm, Key, Version, Origin, IssuedAt,
+		NodesReached, AliveNodes, Converged, ConvergenceTime
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	for _, kc := range results {
+		var convergence any // NULL, если запись дошла не до всех
+		if kc.Converged {
+			convergence = kc.Convergence
+		}
+		_, err := db.Exec(query,
+			flags.Exper.ID,
+			algo,
+			kc.Key,
+			kc.Version,
+			kc.Origin,
+			kc.IssuedAt,
+			kc.NodesReached,
+			kc.AliveNodes,
+			kc.Converged,
+			convergence,
+		)
+		if err != nil {
+			log.Printf("Failed to insert %s: %v", keysTableName, err)
+			return err
+		}
+	}
+	return nil
+}
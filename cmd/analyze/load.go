@@ -0,0 +1,100 @@
+package analyze
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+)
+
+var loadTableName = "NodeLoad"
+
+var loadResults []NodeLoad // загрузка узлов последней симуляции
+
+// NodeLoad is how busy one node was: its processing speed, the longest its
+// inbox has been and how many messages it dropped because the inbox was full.
+type NodeLoad struct {
+	NodeID         int
+	ProcessingMean time.Duration
+	LongestInbox   int
+	InboxDrops     int
+	GotMessage     bool
+}
+
+// getNodeLoad collects the load of every node and fills the overflow columns of the summary.
+func getNodeLoad(nodes []*node.Node) []NodeLoad {
+	Summary.InboxDrops = 0
+	Summary.OverloadedNodes = 0
+	results := make([]NodeLoad, 0, len(nodes))
+	for _, n := range nodes {
+		drops, longest := n.InboxStats()
+		Summary.InboxDrops += drops
+		if drops > 0 {
+			Summary.OverloadedNodes++
+		}
+		results = append(results, NodeLoad{
+			NodeID:         n.ID,
+			ProcessingMean: n.ProcessingMean,
+			LongestInbox:   longest,
+			InboxDrops:     drops,
+			GotMessage:     n.Stored().Data == "OK",
+		})
+	}
+	return results
+}
+
+// loadConfigured reports whether nodes have a processing time or a bounded
+// inbox, i.e. whether the NodeLoad table is worth writing.
+func loadConfigured() bool {
+	return flags.Exper.ProcessingTime > 0 || flags.Exper.InboxCapacity > 0
+}
+
+func createLoadTable(db *sql.DB) {
+	sqlStmt := `
+	CREATE TABLE IF NOT EXISTS ` + loadTableName + ` (
+	ID					       INTEGER PRIMARY KEY AUTOINCREMENT,
+    ExperimentID               INTEGER,
+	Algorithm                  TEXT,
+    NodeID                     INTEGER,
+    ProcessingMean             REAL,
+    InboxCapacity              INTEGER,
+    LongestInbox               INTEGER,
+    InboxDrops                 INTEGER,
+    GotMessage                 BOOLEAN
+);`
+
+	_, err := db.Exec(sqlStmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	flags.VPrintln("Table", loadTableName, "created successfully")
+}
+
+func writeLoadToDB(db *sql.DB, algo string, results []NodeLoad) error {
+	query := `
+	INSERT INTO ` + loadTableName + ` (
+		ExperimentID, Algorithm, NodeID, ProcessingMean, InboxCapacity,
+		LongestInbox, InboxDrops, GotMessage
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	for _, l := range results {
+		_, err := db.Exec(query,
+			flags.Exper.ID,
+			algo,
+			l.NodeID,
+			l.ProcessingMean,
+			node.InboxCapacity(),
+			l.LongestInbox,
+			l.InboxDrops,
+			l.GotMessage,
+		)
+		if err != nil {
+			log.Printf("Failed to insert %s: %v", loadTableName, err)
+			return err
+		}
+	}
+	return nil
+}
@@ -19,9 +19,74 @@ type Experiment struct {
 	MulticastDomains      int
 	GossipFanOut          int
 	DelayMean             int
+	DelayDistribution     string
+	DelayStdDev           float64
+	DelayShape            float64
 	AliveProbability      float64
 	LossProbability       float64
 	CorruptionProbability float64
+	Seed                  int64
+	VirtualTime           bool
+	LinkModel             string
+	InterDelayMean        float64
+	InterLoss             float64
+	InterCorruption       float64
+	LinkFile              string
+	LossModel             string
+	GEGoodToBad           float64
+	GEBadToGood           float64
+	GELossGood            float64
+	GELossBad             float64
+	Partitions            string
+	MessageSize           int
+	UplinkMbps            float64
+	DownlinkMbps          float64
+	DuplicateProbability  float64
+	ReorderProbability    float64
+	ReorderWindow         float64
+	Checksum              bool
+	ChurnMTTF             float64
+	ChurnMTTR             float64
+	ChurnDistribution     string
+	ChurnSchedule         string
+	ByzantineFraction     float64
+	ByzantineIDs          string
+	ByzantineBehavior     string
+	ByzantineTolerance    int
+	Keys                  int
+	Updates               int
+	UpdateInterval        float64
+	VectorClocks          bool
+	CrashState            string
+	SnapshotInterval      float64
+	Reliable              bool
+	Retries               int
+	AckTimeout            float64
+	Backoff               float64
+	Transport             string
+	ProcessingTime        float64
+	ProcessingDist        string
+	ProcessingSpread      float64
+	ProcessingShape       float64
+	InboxCapacity         int
+	Overflow              string
+	Topology              string
+	TopologyDegree        int
+	TopologyProb          float64
+	TopologyFile          string
+	Membership            string
+	ViewSize              int
+	ShuffleLength         int
+	PassiveViewSize       int
+	TreeDepth             int
+	TreeBranching         int
+	Coords                string
+	CoordDims             int
+	CoordSize             float64
+	CoordSpread           float64
+	CoordFile             string
+	Jitter                float64
+	Locality              float64
 }
 
 var Exper Experiment // Экспериментальные параметры
@@ -39,11 +104,76 @@ func RegisterFlags() {
 	flag.IntVar(&Exper.Timer, "timer", 0, "Wait time in seconds before starting the simulation (0 for no wait)")
 	flag.IntVar(&Exper.NodeCount, "nodes", 10, "number of nodes")
 	flag.IntVar(&Exper.MulticastDomains, "domains", 3, "number of domains for multicast simulation")
+	flag.IntVar(&Exper.TreeDepth, "tree-depth", 0, "depth of the k-ary multicast tree (0 with -tree-branching 0: two levels through the domain senders)")
+	flag.IntVar(&Exper.TreeBranching, "tree-branching", 0, "children of every inner node of the k-ary multicast tree (0: the smallest that fits -tree-depth)")
 	flag.IntVar(&Exper.GossipFanOut, "fanout", 1, "Gossip fan-out factor (number of nodes to which each node sends messages)")
 	flag.IntVar(&Exper.DelayMean, "delay", 20, "network delay")
+	flag.StringVar(&Exper.DelayDistribution, "delay-dist", "uniform", "delay distribution: uniform, constant, exponential, normal, lognormal, pareto")
+	flag.Float64Var(&Exper.DelayStdDev, "delay-stddev", 0, "delay standard deviation in ms for normal and lognormal (0 for delay/2)")
+	flag.Float64Var(&Exper.DelayShape, "delay-shape", 2.5, "Pareto shape (tail index, must be > 1)")
+	flag.StringVar(&Exper.LinkModel, "links", "uniform", "link model: uniform, domains (intra/inter multicast domain), file or coords (distance between node coordinates)")
+	flag.Float64Var(&Exper.InterDelayMean, "inter-delay", -1, "mean delay in ms between multicast domains (-1 to reuse -delay)")
+	flag.Float64Var(&Exper.InterLoss, "inter-loss", -1, "message loss probability between multicast domains (-1 to reuse -loss)")
+	flag.Float64Var(&Exper.InterCorruption, "inter-corrupt", -1, "message corruption probability between multicast domains (-1 to reuse -corrupt)")
+	flag.StringVar(&Exper.LinkFile, "link-file", "", "CSV file with from,to,delay,loss,corrupt rows for -links file")
+	flag.StringVar(&Exper.Coords, "coords", "", "place nodes in a latency space: uniform, clustered (around a centre per domain) or file (empty: no coordinates)")
+	flag.IntVar(&Exper.CoordDims, "coord-dims", 2, "dimensions of the latency space: 2 or 3")
+	flag.Float64Var(&Exper.CoordSize, "coord-size", 100, "side of the latency space in ms")
+	flag.Float64Var(&Exper.CoordSpread, "coord-spread", 10, "standard deviation in ms of clustered nodes around the centre of their domain")
+	flag.StringVar(&Exper.CoordFile, "coord-file", "", "file with \"id x y [z]\" rows for -coords file")
+	flag.Float64Var(&Exper.Jitter, "jitter", 5, "mean jitter in ms added to the distance with -links coords, drawn from -delay-dist")
+	flag.Float64Var(&Exper.Locality, "locality", 0, "gossip prefers nearby peers with weight 1/(1+distance)^locality (0: uniform choice)")
 	flag.Float64Var(&Exper.AliveProbability, "alive", 1.0, "probability node is alive")
 	flag.Float64Var(&Exper.LossProbability, "loss", 0.03, "message loss probability")
 	flag.Float64Var(&Exper.CorruptionProbability, "corrupt", 0.05, "message corruption probability")
+	flag.BoolVar(&Exper.Checksum, "checksum", true, "verify payload checksums and reject corrupted messages (false lets corruption go undetected)")
+	flag.StringVar(&Exper.LossModel, "loss-model", "bernoulli", "loss model: bernoulli (independent, uses -loss) or gilbert (bursty Gilbert-Elliott)")
+	flag.Float64Var(&Exper.GEGoodToBad, "ge-p", 0.05, "Gilbert-Elliott probability of a link going from good to bad state")
+	flag.Float64Var(&Exper.GEBadToGood, "ge-r", 0.3, "Gilbert-Elliott probability of a link going from bad to good state")
+	flag.Float64Var(&Exper.GELossGood, "ge-loss-good", 0.0, "Gilbert-Elliott loss probability in the good state")
+	flag.Float64Var(&Exper.GELossBad, "ge-loss-bad", 1.0, "Gilbert-Elliott loss probability in the bad state")
+	flag.IntVar(&Exper.MessageSize, "msg-size", 1024, "message size in bytes")
+	flag.Float64Var(&Exper.UplinkMbps, "uplink", 0, "per-node uplink bandwidth in Mbit/s (0 for unlimited)")
+	flag.Float64Var(&Exper.DownlinkMbps, "downlink", 0, "per-node downlink bandwidth in Mbit/s (0 for unlimited)")
+	flag.Float64Var(&Exper.DuplicateProbability, "dup", 0, "message duplication probability")
+	flag.Float64Var(&Exper.ReorderProbability, "reorder", 0, "probability that a message is held back and delivered out of order")
+	flag.Float64Var(&Exper.ReorderWindow, "reorder-window", 50, "maximum extra delay in ms of a reordered message")
+	flag.Float64Var(&Exper.ChurnMTTF, "mttf", 0, "mean time to failure of a node in ms during a run (0 disables random churn)")
+	flag.Float64Var(&Exper.ChurnMTTR, "mttr", 0, "mean time to recovery of a crashed node in ms (0: crashed nodes stay down)")
+	flag.StringVar(&Exper.ChurnDistribution, "churn-dist", "exponential", "distribution of up and down times: uniform, constant, exponential, normal, lognormal, pareto")
+	flag.StringVar(&Exper.ChurnSchedule, "churn", "", "scheduled outages, e.g. \"3,5-7@100ms-400ms;10@1s\" (no end: the nodes stay down)")
+	flag.Float64Var(&Exper.ByzantineFraction, "byzantine", 0, "fraction of Byzantine nodes (the root node 0 is always honest)")
+	flag.StringVar(&Exper.ByzantineIDs, "byzantine-ids", "", "explicit Byzantine node IDs, e.g. \"3,5-7\" (overrides -byzantine)")
+	flag.StringVar(&Exper.ByzantineBehavior, "byzantine-behavior", "forge", "Byzantine behavior: forge, equivocate, drop, replay or mixed")
+	flag.IntVar(&Exper.ByzantineTolerance, "byzantine-tolerance", 0, "accept a message only after f+1 distinct senders relayed it (0 accepts the first copy)")
+	flag.IntVar(&Exper.Keys, "keys", 0, "number of keys in the key-value store of every node (0 disseminates a single message)")
+	flag.IntVar(&Exper.Updates, "updates", 0, "number of key updates written at random nodes during the run")
+	flag.Float64Var(&Exper.UpdateInterval, "update-interval", 100, "interval between key updates in milliseconds")
+	flag.StringVar(&Exper.CrashState, "crash-state", "keep", "what survives a crash: keep (all state) or snapshot (only the last snapshot file)")
+	flag.Float64Var(&Exper.SnapshotInterval, "snapshot-interval", 0, "interval between snapshots in milliseconds with -crash-state snapshot (0 persists every change)")
+	flag.BoolVar(&Exper.Reliable, "reliable", false, "acknowledge every message and retransmit it until it is acknowledged")
+	flag.IntVar(&Exper.Retries, "retries", 3, "retransmissions of an unacknowledged message with -reliable")
+	flag.Float64Var(&Exper.AckTimeout, "ack-timeout", 50, "wait for the acknowledgement of the first attempt in milliseconds with -reliable")
+	flag.Float64Var(&Exper.Backoff, "backoff", 2, "factor the acknowledgement timeout grows by after every attempt with -reliable")
+	flag.StringVar(&Exper.Transport, "transport", "sim", "how messages travel: sim (network simulator), udp or tcp (localhost sockets, real time only)")
+	flag.Float64Var(&Exper.ProcessingTime, "proc-time", 0, "mean time in ms a node takes to handle a message (0 handles messages instantly)")
+	flag.StringVar(&Exper.ProcessingDist, "proc-dist", "exponential", "distribution of processing times: uniform, constant, exponential, normal, lognormal, pareto")
+	flag.Float64Var(&Exper.ProcessingShape, "proc-shape", 2.5, "Pareto shape of processing times (tail index, must be > 1), independent of -delay-shape")
+	flag.Float64Var(&Exper.ProcessingSpread, "proc-spread", 1, "per-node mean processing times are spread log-uniformly over [mean/spread, mean*spread] (1: all nodes alike)")
+	flag.IntVar(&Exper.InboxCapacity, "inbox", 0, "capacity of the inbox of every node (0: the number of nodes)")
+	flag.StringVar(&Exper.Overflow, "overflow", "block", "what a full inbox does with a new message: block, drop-newest or drop-oldest")
+	flag.StringVar(&Exper.Topology, "topology", "complete", "overlay graph: complete, ring, line, star, grid, torus, regular, erdos-renyi, barabasi-albert, watts-strogatz")
+	flag.IntVar(&Exper.TopologyDegree, "topology-degree", 4, "degree of regular and watts-strogatz topologies, edges per new node of barabasi-albert")
+	flag.Float64Var(&Exper.TopologyProb, "topology-prob", 0.1, "edge probability of erdos-renyi, rewiring probability of watts-strogatz")
+	flag.StringVar(&Exper.TopologyFile, "topology-file", "", "load the overlay from an edge list, DOT (.dot, .gv) or GraphML (.graphml) file instead of -topology")
+	flag.StringVar(&Exper.Membership, "membership", "full", "peer sampling for gossip: full (all Peers), cyclon or hyparview (partial views)")
+	flag.IntVar(&Exper.ViewSize, "view-size", 8, "size of the Cyclon view or of the HyParView active view")
+	flag.IntVar(&Exper.ShuffleLength, "shuffle-len", 4, "number of view entries exchanged in one shuffle")
+	flag.IntVar(&Exper.PassiveViewSize, "passive-size", 32, "size of the HyParView passive view")
+	flag.BoolVar(&Exper.VectorClocks, "vector-clocks", false, "carry vector clocks on messages and events in addition to Lamport timestamps")
+	flag.StringVar(&Exper.Partitions, "partitions", "", "scheduled partitions, e.g. \"0-49|50-99@200ms-800ms;domains@1s-2s\"")
+	flag.Int64Var(&Exper.Seed, "seed", 0, "random seed for reproducible runs (0 for a time-based seed)")
+	flag.BoolVar(&Exper.VirtualTime, "virtual", false, "run on a discrete-event virtual clock instead of real time")
 
 }
 
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/analyze"
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/capacity"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/churn"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/coords"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/dissemination"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/membership"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/metrics"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/reliable"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/socket"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/topology"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/workload"
 	"github.com/fatih/color"
 )
 
@@ -19,6 +30,16 @@ var bold = color.New(color.Bold, color.BgCyan)
 
 const errSimulationPreparation = "Error during simulation preparation"
 
+var byzantineRoles []string // поведение каждого узла, "" для честных
+
+var reliableLayer *reliable.Transport // nil без -reliable
+
+var socketLayer *socket.Transport // nil с -transport sim
+
+var overlay *topology.Graph // nil для полного графа
+
+var placement *coords.Space // nil без -coords
+
 func init() {
 	flags.RegisterFlags()
 	flag.Parse()
@@ -37,6 +58,16 @@ func main() {
 
 	bold.Println("\n==== Preparing Simulation ====")
 
+	if flags.Exper.Seed == 0 {
+		flags.Exper.Seed = time.Now().UnixNano()
+	}
+	fmt.Println("Random seed:", flags.Exper.Seed)
+
+	sim.UseVirtualTime(flags.Exper.VirtualTime)
+	if flags.Exper.VirtualTime {
+		fmt.Println("Using virtual time")
+	}
+
 	// flags.Exper = flags.Experiment{
 	// 	ID:                    0, // ID эксперимента, можно использовать для сохранения результатов в БД
 	// 	Timer:                 0,
@@ -49,11 +80,102 @@ func main() {
 	// 	CorruptionProbability: 0.22, // вероятность потери или порчи сообщения
 	// }
 
-	networkSimulator := network.NewSimulator(flags.Exper)
+	networkSimulator, err := network.NewSimulator(flags.Exper)
+	if err != nil {
+		fmt.Println("Error creating network simulator:", err)
+		return
+	}
+	if err := churn.Configure(flags.Exper); err != nil {
+		fmt.Println("Error configuring churn:", err)
+		return
+	}
+	if err := capacity.Configure(flags.Exper); err != nil {
+		fmt.Println("Error configuring node capacity:", err)
+		return
+	}
+	if err := membership.Configure(flags.Exper); err != nil {
+		fmt.Println("Error configuring membership:", err)
+		return
+	}
+	if _, _, err := dissemination.TreeShape(flags.Exper.NodeCount, flags.Exper.TreeDepth, flags.Exper.TreeBranching); err != nil {
+		fmt.Println("Error configuring multicast tree:", err)
+		return
+	}
+	if err := workload.Configure(flags.Exper); err != nil {
+		fmt.Println("Error configuring key updates:", err)
+		return
+	}
+	var transport node.Transport = networkSimulator
+	if flags.Exper.Transport != socket.Simulated {
+		socketLayer, err = socket.New(flags.Exper)
+		if err != nil {
+			fmt.Println("Error configuring transport:", err)
+			return
+		}
+		transport = socketLayer
+		fmt.Println("Using", flags.Exper.Transport, "sockets on localhost")
+	}
+	if flags.Exper.Reliable {
+		reliableLayer, err = reliable.New(transport, flags.Exper)
+		if err != nil {
+			fmt.Println("Error configuring reliable delivery:", err)
+			return
+		}
+	}
+	placement, err = coords.Place(flags.Exper, func(id int) int {
+		return network.DomainOf(id, flags.Exper.MulticastDomains)
+	})
+	if err != nil {
+		fmt.Println("Error placing nodes:", err)
+		return
+	}
+	if flags.Exper.LinkModel == network.LinksCoords {
+		if placement == nil {
+			fmt.Println("Error: -links coords needs node coordinates (-coords)")
+			return
+		}
+		networkSimulator.Links, err = network.NewCoordLinks(networkSimulator.Links, flags.Exper, placement.Distance)
+		if err != nil {
+			fmt.Println("Error configuring coordinate links:", err)
+			return
+		}
+	}
+	overlay, err = topology.Build(flags.Exper) // один и тот же граф во всех симуляциях
+	if err != nil {
+		fmt.Println("Error building topology:", err)
+		return
+	}
+	if overlay != nil {
+		fmt.Println("Topology:", overlay.Name, "with", overlay.Edges(), "edges")
+		// задержки и потери рёбер из файла топологии заменяют свойства каналов
+		networkSimulator.Links, err = network.EdgeLinks(networkSimulator.Links, flags.Exper, overlay.Links)
+		if err != nil {
+			fmt.Println("Error applying topology links:", err)
+			return
+		}
+	}
+	if socketLayer != nil {
+		ignored := socket.Ignored(flags.Exper)
+		if overlay != nil && len(overlay.Links) > 0 {
+			ignored = append(ignored, "-topology-file latency and loss")
+		}
+		if len(ignored) > 0 {
+			color.HiRed("Warning: the %s transport ignores %s; they apply only to the network simulator", flags.Exper.Transport, strings.Join(ignored, ", "))
+		}
+	}
+	if flags.Exper.NodeCount > 1 {
+		flags.VPrintln("Network delay model of link 0 -> 1:", networkSimulator.Links.Link(0, 1).Delay)
+	}
 	ready := make(chan bool)
 
 	aliveMask := network.SetAlives(flags.Exper) // устанавливаем Alive матрицу для узлов с вероятностью 0.8
 
+	byzantineRoles, err = network.SetByzantine(flags.Exper) // одни и те же византийские узлы во всех симуляциях
+	if err != nil {
+		fmt.Println("Error choosing Byzantine nodes:", err)
+		return
+	}
+
 	broadcastSimulation(flags.Exper, aliveMask, networkSimulator, ready)                            // запускаем симуляцию рассылки
 	singlecastSimulation(flags.Exper, aliveMask, networkSimulator, ready)                           // запускаем симуляцию однокастовой рассылки
 	multicastSimulation(flags.Exper, aliveMask, networkSimulator, ready)                            // запускаем симуляцию однокастовой рассылки
@@ -82,10 +204,27 @@ func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
 
-func simulationPreparation(N int, aliveMaskPtrs []*bool) ([]*node.Node, error) {
-	nodes := node.NewCluster(N) // создаём узлов
+func simulationPreparation(N int, aliveMaskPtrs []*bool, networkSimulator *network.Simulator) (*node.Cluster, error) {
+	cluster := node.NewCluster(N) // создаём узлов
+	nodes := cluster.Nodes
 
 	node.CopyAlive(nodes, aliveMaskPtrs)
+	topology.Apply(nodes, overlay)
+	coords.Apply(nodes, placement)
+	node.CopyByzantine(nodes, byzantineRoles)
+	if err := capacity.Apply(nodes); err != nil {
+		fmt.Println("Error setting processing times:", err)
+		return nil, err
+	}
+	for _, n := range nodes {
+		n.Net = networkSimulator // узлы отправляют сообщения через симулятор сети
+		if socketLayer != nil {
+			n.Net = socketLayer // или через настоящие сокеты
+		}
+		if reliableLayer != nil {
+			n.Net = reliableLayer // подтверждения и повторы поверх сети
+		}
+	}
 
 	err := node.InitCSVFiles(N)
 	if err != nil {
@@ -93,31 +232,68 @@ func simulationPreparation(N int, aliveMaskPtrs []*bool) ([]*node.Node, error) {
 		return nil, err
 	}
 
-	for _, n := range nodes {
-		go n.Run()
-		flags.VPrintln("Node", n.ID, "started")
+	sim.Reset() // каждая симуляция начинается с нулевого виртуального времени
+	networkSimulator.Reset()
+	if reliableLayer != nil {
+		reliableLayer.Reset()
+	}
 
+	if err := cluster.Start(context.Background()); err != nil {
+		fmt.Println("Error starting nodes:", err)
+		return nil, err
+	}
+	if socketLayer != nil {
+		if err := socketLayer.Start(nodes); err != nil {
+			fmt.Println("Error opening sockets:", err)
+			cluster.Stop()
+			return nil, err
+		}
 	}
 
-	return nodes, nil
+	churn.Start(nodes)    // узлы отказывают и восстанавливаются по ходу симуляции
+	workload.Start(nodes) // корень записывает ключи, остальные обновления идут по ходу симуляции
+
+	return cluster, nil
+}
+
+// finishSimulation stops churn, key updates and the nodes of a finished
+// simulation, so that event logs are complete and closed before they are aggregated.
+// Deliveries stop first: a node waiting for its reply to be read must not
+// hold up a crash that churn is waiting for.
+func finishSimulation(cluster *node.Cluster) {
+	cluster.Cancel()
+	churn.Stop()
+	workload.Stop()
+	analyze.Summary.Updates = workload.Issued()
+	collectWireStats()
+	collectMembershipStats()
+	leaked, err := cluster.Stop()
+	if err != nil {
+		color.HiRed("Warning: %v", err)
+	}
+	analyze.Summary.LeakedGoroutines = leaked
 }
 
 func broadcastSimulation(exper flags.Experiment, aliveMask []*bool, networkSimulator *network.Simulator, ready chan bool) {
 
-	nodes, err := simulationPreparation(exper.NodeCount, aliveMask) // создаём узлы и запускаем их
+	cluster, err := simulationPreparation(exper.NodeCount, aliveMask, networkSimulator) // создаём узлы и запускаем их
 	if err != nil {
 		fmt.Println(errSimulationPreparation)
 		return
 	}
+	nodes := cluster.Nodes
 	bold.Println("\n==== Starting Broadcast Simulation ====")
 
 	go dissemination.Broadcast(nodes, networkSimulator, ready)
 	// metrics.StartMonitoring(nodes)
 	waitWithTimer(ready)
+	finishSimulation(cluster)
 	if flags.Flags.Verbose {
 		color.HiMagenta("\n==== Aggregating Broadcast Metrics ====")
 	}
 	metrics.AgregateToDB("Broadcast")
+	metrics.WriteLinkStatesToDB("Broadcast", networkSimulator.TakeLinkTrace())
+	collectNetworkStats(networkSimulator)
 	analyze.Analyze(nodes, "Broadcast")
 
 	color.HiMagenta("Broadcast Simulation completed")
@@ -126,18 +302,22 @@ func broadcastSimulation(exper flags.Experiment, aliveMask []*bool, networkSimul
 func singlecastSimulation(exper flags.Experiment, aliveMask []*bool, networkSimulator *network.Simulator, ready chan bool) {
 	bold.Println("\n==== Starting Singlecast Simulation ====")
 
-	nodes, err := simulationPreparation(exper.NodeCount, aliveMask) // создаём узлы и запускаем их
+	cluster, err := simulationPreparation(exper.NodeCount, aliveMask, networkSimulator) // создаём узлы и запускаем их
 	if err != nil {
 		fmt.Println(errSimulationPreparation)
 		return
 	}
+	nodes := cluster.Nodes
 
 	go dissemination.Singlecast(nodes, networkSimulator, ready)
 	waitWithTimer(ready)
+	finishSimulation(cluster)
 	if flags.Flags.Verbose {
 		color.HiMagenta("\n==== Aggregating Singlecast Metrics ====")
 	}
 	metrics.AgregateToDB("Singlecast")
+	metrics.WriteLinkStatesToDB("Singlecast", networkSimulator.TakeLinkTrace())
+	collectNetworkStats(networkSimulator)
 	analyze.Analyze(nodes, "Singlecast")
 	color.HiMagenta("Singlecast Simulation completed")
 }
@@ -145,18 +325,22 @@ func singlecastSimulation(exper flags.Experiment, aliveMask []*bool, networkSimu
 func multicastSimulation(exper flags.Experiment, aliveMask []*bool, networkSimulator *network.Simulator, ready chan bool) {
 	bold.Println("\n==== Starting Multicast Simulation ====")
 
-	nodes, err := simulationPreparation(exper.NodeCount, aliveMask) // создаём узлы и запускаем их
+	cluster, err := simulationPreparation(exper.NodeCount, aliveMask, networkSimulator) // создаём узлы и запускаем их
 	if err != nil {
 		fmt.Println(errSimulationPreparation)
 		return
 	}
+	nodes := cluster.Nodes
 
-	go dissemination.Multicast(nodes, networkSimulator, exper.MulticastDomains, ready)
+	go dissemination.Multicast(nodes, networkSimulator, exper.MulticastDomains, exper.TreeDepth, exper.TreeBranching, ready)
 	waitWithTimer(ready)
+	finishSimulation(cluster)
 	if flags.Flags.Verbose {
 		color.HiMagenta("\n==== Aggregating Multicast Metrics ====")
 	}
 	metrics.AgregateToDB("Multicast")
+	metrics.WriteLinkStatesToDB("Multicast", networkSimulator.TakeLinkTrace())
+	collectNetworkStats(networkSimulator)
 	analyze.Analyze(nodes, "Multicast")
 	color.HiMagenta("Multicast Simulation completed")
 }
@@ -164,23 +348,69 @@ func multicastSimulation(exper flags.Experiment, aliveMask []*bool, networkSimul
 func gossipSimulation(exper flags.Experiment, aliveMask []*bool, networkSimulator *network.Simulator, ready chan bool, mode dissemination.GossipMode) {
 	bold.Printf("\n==== Starting Gossip %v Simulation ====\n", mode)
 
-	nodes, err := simulationPreparation(exper.NodeCount, aliveMask)
+	cluster, err := simulationPreparation(exper.NodeCount, aliveMask, networkSimulator)
 	if err != nil {
 		fmt.Println(errSimulationPreparation)
 		return
 	}
+	nodes := cluster.Nodes
+	membership.Start(nodes, networkSimulator) // частичные представления строятся из Peers
 
 	go dissemination.Gossip(nodes, networkSimulator, exper.GossipFanOut, mode, ready)
 	waitWithTimer(ready)
+	finishSimulation(cluster)
 	if flags.Flags.Verbose {
 		color.HiMagenta("\n==== Aggregating Gossip Metrics ====")
 	}
 
 	metrics.AgregateToDB(fmt.Sprintf("Gossip%v", mode))
+	metrics.WriteLinkStatesToDB(fmt.Sprintf("Gossip%v", mode), networkSimulator.TakeLinkTrace())
+	collectNetworkStats(networkSimulator)
 	analyze.Analyze(nodes, fmt.Sprintf("Gossip%v", mode))
 	color.HiMagenta("Gossip Simulation completed")
 }
 
+// collectNetworkStats copies the network counters of the finished simulation into the analysis summary.
+func collectNetworkStats(networkSimulator *network.Simulator) {
+	stats := networkSimulator.Stats()
+	analyze.Summary.PartitionDrops = stats.PartitionDrops
+	analyze.Summary.AvgQueueingDelay = 0
+	if stats.QueuedMessages > 0 {
+		analyze.Summary.AvgQueueingDelay = stats.QueueingDelay / time.Duration(stats.QueuedMessages)
+	}
+	analyze.Summary.MaxQueueingDelay = stats.MaxQueueingDelay
+	analyze.Summary.HealTime, _ = networkSimulator.HealTime()
+}
+
+// collectMembershipStats copies the peer sampling counters of the finished
+// simulation into the analysis summary.
+func collectMembershipStats() {
+	stats := membership.Stop()
+	analyze.Summary.MembershipMessages = stats.Messages
+	analyze.Summary.AvgViewSize = stats.AvgViewSize
+	analyze.Summary.MaxViewInDegree = stats.MaxInDegree
+}
+
+// collectWireStats closes the sockets of the finished simulation and copies
+// the serialization counters into the analysis summary.
+func collectWireStats() {
+	analyze.Summary.WireBytes = 0
+	analyze.Summary.AvgEncodeTime = 0
+	analyze.Summary.AvgDecodeTime = 0
+	if socketLayer == nil {
+		return
+	}
+	socketLayer.Close()
+	stats := socketLayer.Stats()
+	analyze.Summary.WireBytes = stats.Bytes
+	if stats.Frames > 0 {
+		analyze.Summary.AvgEncodeTime = stats.EncodeTime / time.Duration(stats.Frames)
+	}
+	if stats.Decoded > 0 {
+		analyze.Summary.AvgDecodeTime = stats.DecodeTime / time.Duration(stats.Decoded)
+	}
+}
+
 func waitWithTimer(ready chan bool) {
 	timer := flags.Exper.Timer // получаем значение таймера из флагов
 	if timer <= 0 {
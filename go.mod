@@ -3,9 +3,12 @@ module github.com/Tarat0r/distributed-systems-modeling
 go 1.24.2
 
 require (
-	github.com/fatih/color v1.18.0 // indirect
+	github.com/fatih/color v1.18.0
+	github.com/mattn/go-sqlite3 v1.14.28
+)
+
+require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 )
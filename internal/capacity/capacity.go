@@ -0,0 +1,101 @@
+// Package capacity gives nodes a finite processing speed.
+//
+// Each node takes a time drawn from the processing-time distribution to
+// handle a message, and messages that arrive meanwhile wait in its bounded
+// inbox. With a spread above 1 nodes differ: the mean of every node is drawn
+// log-uniformly between mean/spread and mean*spread, so some nodes are
+// several times slower than others.
+package capacity
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+)
+
+// Model describes the processing speed of the nodes of one experiment.
+type Model struct {
+	Dist   string
+	Mean   float64 // среднее время обработки в миллисекундах
+	Spread float64
+	Shape  float64 // показатель хвоста для распределения Парето
+	Seed   int64
+}
+
+var (
+	mu    sync.Mutex
+	model *Model
+)
+
+// Configure builds the processing model and checks the inbox parameters.
+// Without -proc-time nodes handle messages instantly.
+func Configure(exper flags.Experiment) error {
+	switch exper.Overflow {
+	case node.OverflowBlock, node.OverflowDropNewest, node.OverflowDropOldest:
+	default:
+		return fmt.Errorf("unknown overflow policy %q (block, drop-newest or drop-oldest)", exper.Overflow)
+	}
+	if exper.InboxCapacity < 0 {
+		return fmt.Errorf("inbox capacity must not be negative")
+	}
+	if exper.ProcessingTime < 0 {
+		return fmt.Errorf("processing time must not be negative")
+	}
+	if exper.ProcessingSpread < 1 {
+		return fmt.Errorf("processing spread must be at least 1")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	model = nil
+	if exper.ProcessingTime == 0 {
+		return nil
+	}
+	m := &Model{
+		Dist:   exper.ProcessingDist,
+		Mean:   exper.ProcessingTime,
+		Spread: exper.ProcessingSpread,
+		Shape:  exper.ProcessingShape,
+		Seed:   exper.Seed,
+	}
+	// проверяем распределение сразу, а не при запуске первой симуляции
+	if _, err := network.NewDelayModel(m.Dist, m.Mean, 0, m.Shape); err != nil {
+		return fmt.Errorf("processing time: %w", err)
+	}
+	model = m
+	return nil
+}
+
+// Apply gives every node its processing time. It must be called before the
+// cluster starts. Every simulation draws the same node speeds, so the
+// algorithms face the same slow nodes.
+func Apply(nodes []*node.Node) error {
+	mu.Lock()
+	m := model
+	mu.Unlock()
+	if m == nil {
+		return nil
+	}
+
+	spread := rng.New(m.Seed, "processing-spread")
+	for _, n := range nodes {
+		mean := m.Mean
+		if m.Spread > 1 {
+			mean *= math.Pow(m.Spread, 2*spread.Float64()-1)
+		}
+		dm, err := network.NewDelayModel(m.Dist, mean, 0, m.Shape)
+		if err != nil {
+			return fmt.Errorf("processing time of node %d: %w", n.ID, err)
+		}
+		rs := rng.New(m.Seed, "processing", n.ID)
+		n.ProcessingMean = time.Duration(mean * float64(time.Millisecond))
+		n.Processing = func() time.Duration { return dm.Sample(rs) }
+	}
+	return nil
+}
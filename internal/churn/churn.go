@@ -0,0 +1,283 @@
+// Package churn crashes and recovers nodes while a dissemination algorithm runs.
+//
+// Two sources of churn can be combined: random failures, where every node
+// that starts alive alternates between up periods drawn from the MTTF
+// distribution and down periods drawn from the MTTR distribution, and an
+// explicit schedule of outages. Crash and recovery events are written to the
+// event log of the node. With -crash-state snapshot and a snapshot interval
+// the package also persists the nodes periodically.
+package churn
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// Outage takes a set of nodes down at Start and brings them back at End,
+// both measured from the start of the simulation. A zero End means the
+// nodes never recover.
+type Outage struct {
+	Nodes []int
+	Start time.Duration
+	End   time.Duration
+}
+
+// Model describes the churn of one experiment.
+type Model struct {
+	MTTF     network.DelayModel // nil: узлы не отказывают случайно
+	MTTR     network.DelayModel // nil: отказавший узел не восстанавливается
+	Schedule []Outage
+	Seed     int64
+	// Snapshot is the interval between snapshots of the nodes when crashes
+	// lose volatile state; 0 means nodes persist every change themselves.
+	Snapshot time.Duration
+}
+
+var (
+	mu      sync.Mutex
+	model   *Model
+	current *run
+)
+
+// run is the churn of the running simulation.
+type run struct {
+	mu         sync.Mutex
+	timers     []*sim.Timer
+	recovering int // запланированные восстановления
+	stopped    bool
+	active     sync.WaitGroup // события, которые выполняются прямо сейчас
+}
+
+// Configure builds the churn model from the experiment parameters.
+// Without -mttf and -churn the nodes keep their initial state.
+func Configure(exper flags.Experiment) error {
+	m := &Model{Seed: exper.Seed}
+	var err error
+	if exper.ChurnMTTF > 0 {
+		m.MTTF, err = network.NewDelayModel(exper.ChurnDistribution, exper.ChurnMTTF, 0, exper.DelayShape)
+		if err != nil {
+			return fmt.Errorf("churn MTTF: %w", err)
+		}
+		if exper.ChurnMTTR > 0 {
+			m.MTTR, err = network.NewDelayModel(exper.ChurnDistribution, exper.ChurnMTTR, 0, exper.DelayShape)
+			if err != nil {
+				return fmt.Errorf("churn MTTR: %w", err)
+			}
+		}
+	}
+	m.Schedule, err = ParseSchedule(exper.ChurnSchedule, exper.NodeCount)
+	if err != nil {
+		return err
+	}
+	switch exper.CrashState {
+	case node.CrashStateKeep:
+	case node.CrashStateSnapshot:
+		if exper.SnapshotInterval < 0 {
+			return fmt.Errorf("snapshot interval must not be negative")
+		}
+		m.Snapshot = time.Duration(exper.SnapshotInterval * float64(time.Millisecond))
+	default:
+		return fmt.Errorf("unknown crash state %q", exper.CrashState)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	model = m
+	return nil
+}
+
+// ParseSchedule parses outages separated by ';'. Each outage has the form
+// NODES@START-END or NODES@START for nodes that never recover, where NODES
+// is a list of node IDs and ranges, e.g.
+//
+//	3,5-7@100ms-400ms;10@1s
+func ParseSchedule(spec string, nodeCount int) ([]Outage, error) {
+	var outages []Outage
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		nodesSpec, window, ok := strings.Cut(item, "@")
+		if !ok {
+			return nil, fmt.Errorf("outage %q: missing @START", item)
+		}
+		ids, err := network.ParseNodeList(nodesSpec, nodeCount)
+		if err != nil {
+			return nil, fmt.Errorf("outage %q: %w", item, err)
+		}
+		o := Outage{Nodes: ids}
+		startSpec, endSpec, hasEnd := strings.Cut(window, "-")
+		if o.Start, err = network.ParseMillis(startSpec); err != nil {
+			return nil, fmt.Errorf("outage %q: start: %w", item, err)
+		}
+		if hasEnd {
+			if o.End, err = network.ParseMillis(endSpec); err != nil {
+				return nil, fmt.Errorf("outage %q: end: %w", item, err)
+			}
+			if o.End <= o.Start {
+				return nil, fmt.Errorf("outage %q: end must be after start", item)
+			}
+		}
+		outages = append(outages, o)
+	}
+	return outages, nil
+}
+
+// Start schedules crashes and recoveries for a new simulation. Nodes that are
+// dead from the start stay dead unless the schedule recovers them. Every
+// simulation draws the same failure times, so the algorithms face the same churn.
+func Start(nodes []*node.Node) {
+	mu.Lock()
+	m := model
+	r := &run{}
+	current = r
+	mu.Unlock()
+	if m == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m.Snapshot > 0 {
+		r.scheduleSnapshots(m, nodes)
+	}
+	if m.MTTF != nil {
+		for _, n := range nodes {
+			if n.IsAlive() {
+				r.scheduleCrash(m, n, rng.New(m.Seed, "churn", n.ID))
+			}
+		}
+	}
+	for _, o := range m.Schedule {
+		for _, id := range o.Nodes {
+			if id >= len(nodes) {
+				continue
+			}
+			n := nodes[id]
+			r.after(o.Start, func() { crash(n) })
+			if o.End > 0 {
+				r.recovering++
+				r.after(o.End, func() {
+					restore(n)
+					r.mu.Lock()
+					defer r.mu.Unlock()
+					r.recovering--
+				})
+			}
+		}
+	}
+}
+
+// Stop cancels the pending crashes and recoveries of the finished simulation.
+func Stop() {
+	mu.Lock()
+	r := current
+	current = nil
+	mu.Unlock()
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.stopped = true
+	for _, t := range r.timers {
+		t.Stop()
+	}
+	r.timers = nil
+	r.recovering = 0
+	r.mu.Unlock()
+	r.active.Wait() // отказ, который уже начался, дописывается в журнал узла
+}
+
+// RecoveryPending reports whether a crashed node is still going to come back.
+func RecoveryPending() bool {
+	mu.Lock()
+	r := current
+	mu.Unlock()
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recovering > 0
+}
+
+// after runs fn after d unless the simulation has stopped.
+// Must be called with r.mu held. fn runs without r.mu: a crash waits for the
+// node, and Stop must not wait for a node while holding the lock.
+func (r *run) after(d time.Duration, fn func()) {
+	if r.stopped {
+		return
+	}
+	r.timers = append(r.timers, sim.AfterFunc(d, func() {
+		r.mu.Lock()
+		if r.stopped {
+			r.mu.Unlock()
+			return
+		}
+		r.active.Add(1)
+		r.mu.Unlock()
+		defer r.active.Done()
+		fn()
+	}))
+}
+
+// scheduleCrash lets the node fail after an up period drawn from MTTF and
+// recover after a down period drawn from MTTR, then repeats.
+func (r *run) scheduleCrash(m *Model, n *node.Node, rs *rng.Stream) {
+	r.after(m.MTTF.Sample(rs), func() {
+		crash(n)
+		if m.MTTR == nil {
+			return // без MTTR узел отказывает навсегда
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.recovering++
+		r.after(m.MTTR.Sample(rs), func() {
+			restore(n)
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.recovering-- // только после восстановления, чтобы узел не сочли потерянным
+			r.scheduleCrash(m, n, rs)
+		})
+	})
+}
+
+// scheduleSnapshots persists every node that is up each snapshot interval.
+func (r *run) scheduleSnapshots(m *Model, nodes []*node.Node) {
+	r.after(m.Snapshot, func() {
+		for _, n := range nodes {
+			if !n.IsAlive() {
+				continue // упавший узел ничего не пишет
+			}
+			if err := n.Snapshot(); err != nil {
+				fmt.Println("Error writing snapshot:", err)
+			}
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.scheduleSnapshots(m, nodes)
+	})
+}
+
+func crash(n *node.Node) {
+	if err := n.Crash(); err != nil {
+		fmt.Println("Error logging crash of node", n.ID, ":", err)
+	}
+}
+
+func restore(n *node.Node) {
+	if err := n.Recover(); err != nil {
+		fmt.Println("Error logging recovery of node", n.ID, ":", err)
+	}
+}
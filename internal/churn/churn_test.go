@@ -0,0 +1,54 @@
+package churn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []Outage
+		wantErr string
+	}{
+		{
+			name: "ranges and a permanent outage",
+			spec: "3,5-7@100ms-400ms;9@1s",
+			want: []Outage{
+				{Nodes: []int{3, 5, 6, 7}, Start: 100 * time.Millisecond, End: 400 * time.Millisecond},
+				{Nodes: []int{9}, Start: time.Second},
+			},
+		},
+		{
+			name: "plain milliseconds and blank items",
+			spec: " 0@50-75.5 ; ;",
+			want: []Outage{{Nodes: []int{0}, Start: 50 * time.Millisecond, End: 75500 * time.Microsecond}},
+		},
+		{name: "empty", spec: ""},
+		{name: "missing start", spec: "1-2", wantErr: "missing @START"},
+		{name: "end before start", spec: "1@300-200", wantErr: "end must be after start"},
+		{name: "bad start", spec: "1@soon", wantErr: "start"},
+		{name: "bad end", spec: "1@100-later", wantErr: "end"},
+		{name: "node out of range", spec: "10@100", wantErr: `node range "10" out of [0, 10)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchedule(tt.spec, 10)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSchedule() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedule() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSchedule() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Package coords places the nodes in a 2D or 3D latency space, where the
+// distance between two nodes is the base one-way delay between them in
+// milliseconds.
+//
+// Nodes are placed uniformly in a cube, in clusters around one random centre
+// per multicast domain, or at the positions listed in a file. The placement
+// is drawn from its own stream, so every simulation of an experiment uses
+// the same positions.
+package coords
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+)
+
+// Supported placements.
+const (
+	Uniform   = "uniform"
+	Clustered = "clustered" // узлы домена вокруг общего центра
+	File      = "file"
+)
+
+// Space holds the position of every node.
+type Space struct {
+	Mode   string
+	Points [][]float64
+}
+
+// Place positions the nodes of the experiment; domainOf gives the multicast
+// domain of a node for clustered placement. Without -coords it returns nil.
+func Place(exper flags.Experiment, domainOf func(id int) int) (*Space, error) {
+	if exper.Coords == "" {
+		return nil, nil
+	}
+	n := exper.NodeCount
+	dims := exper.CoordDims
+	if exper.Coords != File && dims != 2 && dims != 3 {
+		return nil, fmt.Errorf("coordinates must have 2 or 3 dimensions, got %d", dims)
+	}
+	if exper.CoordSize < 0 || exper.CoordSpread < 0 {
+		return nil, fmt.Errorf("coordinate space size and spread must not be negative")
+	}
+	rs := rng.New(exper.Seed, "coords")
+
+	s := &Space{Mode: exper.Coords, Points: make([][]float64, n)}
+	switch exper.Coords {
+	case Uniform:
+		for i := range s.Points {
+			s.Points[i] = randomPoint(rs, dims, exper.CoordSize)
+		}
+	case Clustered:
+		centres := make(map[int][]float64)
+		for i := range s.Points {
+			d := domainOf(i)
+			if centres[d] == nil {
+				centres[d] = randomPoint(rs, dims, exper.CoordSize)
+			}
+			p := make([]float64, dims)
+			for k := range p {
+				p[k] = centres[d][k] + rs.NormFloat64()*exper.CoordSpread
+			}
+			s.Points[i] = p
+		}
+	case File:
+		var err error
+		s.Points, err = load(exper.CoordFile, n)
+		if err != nil {
+			return nil, fmt.Errorf("coordinate file %s: %w", exper.CoordFile, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown coordinate placement %q (uniform, clustered or file)", exper.Coords)
+	}
+	return s, nil
+}
+
+// Apply gives every node its position; a nil space leaves nodes without one.
+func Apply(nodes []*node.Node, s *Space) {
+	if s == nil {
+		return
+	}
+	for _, n := range nodes {
+		n.Coord = s.Points[n.ID]
+	}
+}
+
+// Distance returns the distance between two nodes in milliseconds.
+func (s *Space) Distance(from, to int) float64 {
+	return Distance(s.Points[from], s.Points[to])
+}
+
+// Distance is the Euclidean distance between two points.
+func Distance(a, b []float64) float64 {
+	sum := 0.0
+	for k := range a {
+		d := a[k] - b[k]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+func randomPoint(rs rng.Source, dims int, size float64) []float64 {
+	p := make([]float64, dims)
+	for k := range p {
+		p[k] = rs.Float64() * size
+	}
+	return p
+}
+
+// load reads one "id x y [z]" row per node, separated by spaces or commas.
+// Blank lines, # comments and a header on the first other line are skipped; every node from 0
+// to n-1 must be listed once, all with the same number of coordinates.
+func load(path string, n int) ([][]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	points := make([][]float64, n)
+	dims := 0
+	first := true // заголовок может идти только первой непустой строкой
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		header := first
+		first = false
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			if header {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: bad node ID %q", line, fields[0])
+		}
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: want id and 2 or 3 coordinates, got %d fields", line, len(fields))
+		}
+		if dims == 0 {
+			dims = len(fields) - 1
+		} else if len(fields)-1 != dims {
+			return nil, fmt.Errorf("line %d: %d coordinates, earlier rows have %d", line, len(fields)-1, dims)
+		}
+		if id < 0 || id >= n {
+			return nil, fmt.Errorf("line %d: node %d out of range 0-%d", line, id, n-1)
+		}
+		if points[id] != nil {
+			return nil, fmt.Errorf("line %d: node %d listed twice", line, id)
+		}
+		p := make([]float64, dims)
+		for k := range p {
+			if p[k], err = strconv.ParseFloat(fields[k+1], 64); err != nil {
+				return nil, fmt.Errorf("line %d: bad coordinate %q", line, fields[k+1])
+			}
+		}
+		points[id] = p
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for id, p := range points {
+		if p == nil {
+			return nil, fmt.Errorf("node %d has no coordinates", id)
+		}
+	}
+	return points, nil
+}
@@ -0,0 +1,95 @@
+package coords
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		nodes   int
+		want    [][]float64
+		wantErr string
+	}{
+		{
+			name:    "spaces",
+			content: "0 0 0\n1 3 4\n",
+			nodes:   2,
+			want:    [][]float64{{0, 0}, {3, 4}},
+		},
+		{
+			name:    "header after comments and blank lines",
+			content: "# координаты\n\nid,x,y,z\n1,1,2,3 # узел 1\n0,0,0,0\n",
+			nodes:   2,
+			want:    [][]float64{{0, 0, 0}, {1, 2, 3}},
+		},
+		{
+			name:    "header only on the first line",
+			content: "0 0 0\nid x y\n1 1 1\n",
+			nodes:   2,
+			wantErr: `line 2: bad node ID "id"`,
+		},
+		{
+			name:    "node listed twice",
+			content: "0 0 0\n0 1 1\n",
+			nodes:   2,
+			wantErr: "line 2: node 0 listed twice",
+		},
+		{
+			name:    "dimension mismatch",
+			content: "0 0 0\n1 1 1 1\n",
+			nodes:   2,
+			wantErr: "line 2: 3 coordinates, earlier rows have 2",
+		},
+		{
+			name:    "node out of range",
+			content: "0 0 0\n2 1 1\n",
+			nodes:   2,
+			wantErr: "line 2: node 2 out of range 0-1",
+		},
+		{
+			name:    "missing node",
+			content: "0 0 0\n",
+			nodes:   2,
+			wantErr: "node 1 has no coordinates",
+		},
+		{
+			name:    "bad coordinate",
+			content: "0 0 x\n",
+			nodes:   1,
+			wantErr: `line 1: bad coordinate "x"`,
+		},
+		{
+			name:    "too few fields",
+			content: "0 0\n",
+			nodes:   1,
+			wantErr: "line 1: want id and 2 or 3 coordinates, got 2 fields",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "coords.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := load(path, tt.nodes)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("load() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,7 @@
 package dissemination
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
 	"sync"
 	"time"
 
@@ -11,6 +9,8 @@ import (
 	"github.com/Tarat0r/distributed-systems-modeling/internal/metrics"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/reliable"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
 	"github.com/fatih/color"
 )
 
@@ -19,32 +19,24 @@ var msgIDMu sync.Mutex
 
 func Broadcast(nodes []*node.Node, simulator *network.Simulator, ready chan bool) {
 	sender := nodes[0] // стартовый узел
-	sender.DB = node.Message{Data: "OK"}
-
-	csvFile, err := os.OpenFile("metrics/metrics_node_"+fmt.Sprintf("%d", sender.ID)+".csv", os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Println("Error opening CSV file:", err)
-		return
-	}
-	writer := &node.SafeWriter{}
-	writer.Writer = csv.NewWriter(csvFile)
-	defer csvFile.Close()
+	sender.Originate(node.NewMessage(sender.ID, 0, "OK"))
 
 	var wg sync.WaitGroup
 	resetMsgID()
 
 	metrics.AddExperimentStartTime()
 
-	wg.Add(1)                                                             // добавляем в WaitGroup, чтобы дождаться завершения отправки сообщений
-	go BroadcastFromNode(sender, simulator, writer, &wg, nextMsgID, "OK") // отправляем сообщения от стартового узла
-	wg.Wait()                                                             // ждем завершения отправки сообщений
-	ready <- true                                                         // сигнализируем, что сообщение отправлено
+	wg.Add(1) // добавляем в WaitGroup, чтобы дождаться завершения отправки сообщений
+	sim.Go(func() {
+		BroadcastFromNode(sender, simulator, &wg, nextMsgID, "OK") // отправляем сообщения от стартового узла
+	})
+	sim.Wait(&wg) // ждем завершения отправки сообщений
+	ready <- true // сигнализируем, что сообщение отправлено
 }
 
 func BroadcastFromNode(
 	sender *node.Node,
 	simulator *network.Simulator,
-	writer *node.SafeWriter,
 	wg *sync.WaitGroup,
 	nextMsgID func() int,
 	msgData string,
@@ -55,30 +47,45 @@ func BroadcastFromNode(
 	defer wg.Done()
 	respChans := make([]chan node.Message, len(sender.Peers))
 	for i := range respChans {
-		respChans[i] = make(chan node.Message, len(sender.Peers)/2)
+		respChans[i] = make(chan node.Message, replyCopies()) // поздний ответ не должен блокировать получателя
 	}
 
+	sent := make([]bool, len(sender.Peers))
 	for k, reciver := range sender.Peers {
 		if reciver.ID == sender.ID {
 			continue
 		}
+		if sender.Crashed() {
+			color.Red("Node %d crashed while broadcasting", sender.ID)
+			break // упавший узел больше ничего не отправляет
+		}
 
-		msg := node.Message{
-			SenderID:     sender.ID,
-			Data:         msgData,
-			MessageID:    nextMsgID(),
-			ResponseChan: respChans[k],
+		msg := sender.Rumor() // пересылаем сохранённую полезную нагрузку вместе с контрольной суммой
+		msg.Data = msgData
+		msg.MessageID = nextMsgID()
+		msg.ResponseChan = respChans[k]
+		msg, ok := sender.Outgoing(msg, reciver.ID)
+		if !ok {
+			continue // византийский узел не отправил сообщение
 		}
 
 		flags.VPrintln(sender.ID, "->", reciver.ID, "msg:", msg)
 
-		wg.Add(1)
-		go simulator.Send(sender, reciver, msg, wg)
-
-		if err := node.WriteToCSV(writer, sender, &msg, "Send"); err != nil {
+		// событие отправки пишется до передачи в сеть, чтобы сообщение несло метку часов
+		if err := sender.LogEvent(&msg, "Send"); err != nil {
 			fmt.Println("Error writing to CSV:", err)
 			return nil
 		}
+
+		wg.Add(1)
+		sent[k] = true
+		sim.Go(func() { sender.Net.Send(sender, reciver, msg, wg) })
+	}
+
+	// с надёжной доставкой ответ может прийти только после повторов
+	wait := 50 * time.Millisecond
+	if rt, ok := sender.Net.(*reliable.Transport); ok {
+		wait += rt.MaxWait()
 	}
 
 	// ждем ответ от всех узлов
@@ -86,13 +93,15 @@ func BroadcastFromNode(
 		if reciver.ID == sender.ID {
 			continue
 		}
+		if !sent[k] {
+			responses = append(responses, "lost")
+			continue
+		}
 
-		select {
-		case resp := <-respChans[k]:
+		if resp, ok := sim.Recv(respChans[k], wait); ok {
 			flags.VPrintln("Got response:", resp)
-			responses = append(responses, resp.Data)
-
-		case <-time.After(50 * time.Millisecond):
+			responses = append(responses, resp.Label())
+		} else {
 			responses = append(responses, "lost")
 			flags.VPrintln("No response received from node", reciver.ID)
 		}
@@ -116,3 +125,16 @@ func resetMsgID() {
 	defer msgIDMu.Unlock()
 	globalMsgID = 0
 }
+
+// replyCopies is how many replies one message can bring: every copy that the
+// network or the reliable transport delivers is answered.
+func replyCopies() int {
+	copies := 1
+	if flags.Exper.Reliable {
+		copies += flags.Exper.Retries
+	}
+	if flags.Exper.DuplicateProbability > 0 {
+		copies *= 2 // каждая попытка может прийти дважды
+	}
+	return copies
+}
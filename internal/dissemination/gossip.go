@@ -1,18 +1,22 @@
 package dissemination
 
 import (
-	"encoding/csv"
 	"fmt"
-	"math/rand"
-	"os"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/analyze"
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/churn"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/coords"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/membership"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/metrics"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/workload"
 )
 
 type GossipMode string
@@ -33,19 +37,24 @@ func Gossip(nodes []*node.Node, simulator *network.Simulator, fanout int, mode G
 		respChans[i] = make(chan node.Message, len(nodes)/2)
 	}
 
-	msg := node.Message{
-		SenderID:  rootNode.ID,
-		Data:      "OK",
-		MessageID: nextMsgID(),
+	rootNode.Originate(node.NewMessage(rootNode.ID, nextMsgID(), "OK"))
+	if mode == GossipPull {
+		for _, n := range nodes {
+			n.Handler = pullHandler{nodes: nodes}
+		}
 	}
-	rootNode.DB = msg
 
-	// Открываем CSV файлы для каждого узла
-	writers, csvFiles := openCSV(nodes)
+	// У каждого узла свой поток случайных чисел для выбора пиров
+	peerRands := make([]*rng.Stream, len(nodes))
+	for i, n := range nodes {
+		peerRands[i] = rng.New(flags.Exper.Seed, "peers", n.ID)
+	}
 
 	// START message
 	metrics.AddExperimentStartTime()
 
+	var distance float64 // сумма расстояний до выбранных пиров
+	var picks int
 	round := 0
 	for {
 		round++
@@ -54,117 +63,214 @@ func Gossip(nodes []*node.Node, simulator *network.Simulator, fanout int, mode G
 			break
 		}
 
-		for _, n := range nodes {
+		for i, n := range nodes {
 			for range fanout {
+				// пир выбирается до запуска горутины, чтобы порядок выборов не зависел от планировщика
+				receiver := selectPeer(n, peerRands[i])
+				if receiver == nil {
+					continue // у узла нет соседей
+				}
+				if n.Coord != nil {
+					distance += coords.Distance(n.Coord, receiver.Coord)
+					picks++
+				}
 				wgGossip.Add(1)
-				go gossipSend(n, simulator, mode, &wgGossip, respChans, writers)
+				sim.Go(func() { gossipSend(n, receiver, mode, &wgGossip, respChans) })
 			}
 		}
-		wgGossip.Wait() // ждем, пока все сообщения будут отправлены
+		sim.Wait(&wgGossip)        // ждем, пока все сообщения будут отправлены
+		sim.Wait(rootNode.Pending) // и пока обработаны запросы pull и ответы на них
 
 		// ждем ответ от всех узлов
 		for k, n := range nodes {
-			select {
-			case resp := <-respChans[k]:
+			if resp, ok := sim.Recv(respChans[k], 50*time.Millisecond); ok {
 				flags.VPrintln("Got response:", resp)
-
-			case <-time.After(50 * time.Millisecond):
+				drainReplies(respChans[k])
+			} else {
 				flags.VPrintln("No response received from node", n.ID)
 			}
 		}
 		// time.Sleep(10 * time.Millisecond)
-		wgGossip.Wait() // ждем, пока все горутины завершатся
+		sim.Wait(&wgGossip) // ждем, пока все горутины завершатся
+		membership.Round()  // узлы обмениваются частями представлений между раундами
 	}
 
 	printResult(nodes)
 
-	fmt.Println("All multicast messages sent, flushing CSV files...")
-	for i := range writers {
-		writers[i].Mutex.Lock()
-		writers[i].Writer.Flush()
-		writers[i].Mutex.Unlock()
-		csvFiles[i].Close()
-	}
-
 	println("✅ All nodes received the message in round", round)
 	analyze.Summary.Rounds = round
+	analyze.Summary.AvgPeerDistance = 0
+	if picks > 0 {
+		analyze.Summary.AvgPeerDistance = distance / float64(picks)
+	}
 
 	ready <- true
 }
 
-func gossipSend(sender *node.Node, simulator *network.Simulator, mode GossipMode, wgGossip *sync.WaitGroup, respChans []chan node.Message, writers []*node.SafeWriter) {
+func gossipSend(sender *node.Node, receiver *node.Node, mode GossipMode, wgGossip *sync.WaitGroup, respChans []chan node.Message) {
 	defer wgGossip.Done()
 
-	receiver := getRandomPeer(sender)
-
-	msgS := node.Message{
-		SenderID:     sender.ID,
-		Data:         sender.DB.Data,
-		MessageID:    sender.DB.MessageID,
-		ResponseChan: respChans[sender.ID],
+	if sender.Crashed() {
+		return // упавший узел не участвует в обмене
 	}
 
-	msgR := node.Message{
-		SenderID:     receiver.ID,
-		Data:         receiver.DB.Data,
-		MessageID:    receiver.DB.MessageID,
-		ResponseChan: respChans[receiver.ID],
-	}
+	msgS := sender.Rumor()
+	msgS.ResponseChan = respChans[sender.ID]
 
-	if receiver == nil {
-		msgS.Data = "lost"
-	}
+	msgR := receiver.Rumor()
+	msgR.ResponseChan = respChans[receiver.ID]
 
 	flags.VPrintln("Node", sender.ID, "is sending a message to", receiver.ID, "msg: ", msgS)
 	switch mode {
 
 	case GossipPush:
 
-		if msgS.Data == "lost" || msgS.Data == "" {
+		// подделывающий узел шлёт фальшивку, даже если сам ничего не получил
+		var ok bool
+		msgS, ok = sender.Outgoing(msgS, receiver.ID)
+		if !ok || msgS.Status == node.Lost || (msgS.Data == "" && len(msgS.Entries) == 0) {
 			return
 		}
-		if err := node.WriteToCSV(writers[sender.ID], sender, &msgS, "Send"); err != nil {
+		if err := sender.LogEvent(&msgS, "Send"); err != nil {
 			fmt.Println("Error writing to CSV:", err)
 			return
 		}
 		wgGossip.Add(1)
-		go simulator.Send(sender, receiver, msgS, wgGossip)
+		sim.Go(func() { sender.Net.Send(sender, receiver, msgS, wgGossip) })
 
 	case GossipPull:
-		if msgR.Data == "OK" || msgR.Data == "corrupted" {
-			return
+		// узел сообщает пиру, что у него есть, и пир присылает недостающее (pullHandler)
+		req := sender.PullRequest()
+		req.ResponseChan = respChans[sender.ID]
+		if err := sender.Send(receiver, req); err != nil {
+			fmt.Println("Error sending message:", err)
 		}
-		if err := node.WriteToCSV(writers[sender.ID], receiver, &msgS, "Send"); err != nil {
-			fmt.Println("Error writing to CSV PushPull:", err)
-		}
-		wgGossip.Add(1)
-		go simulator.Send(sender, receiver, msgS, wgGossip)
 
 	case GossipPushPull:
-		time.Sleep(10 * time.Millisecond) // небольшая задержка для симуляции реального времени
-		err := node.WriteToCSV(writers[sender.ID], sender, &msgS, "Send")
-		err = node.WriteToCSV(writers[receiver.ID], receiver, &msgR, "Send")
-		time.Sleep(10 * time.Millisecond) // небольшая задержка для симуляции реального времени
-		if err != nil {
-			fmt.Println("Error writing to CSV:", err)
+		var push, reply bool
+		msgS, push = sender.Outgoing(msgS, receiver.ID)
+		msgR, reply = receiver.Outgoing(msgR, sender.ID)
+		// небольшая задержка для симуляции реального времени
+		sim.Delay(10*time.Millisecond, func() {
+			// упавший получатель не отвечает своей версией
+			reply = reply && !receiver.Crashed()
+			var err error
+			if push {
+				err = sender.LogEvent(&msgS, "Send")
+			}
+			if reply {
+				err = receiver.LogEvent(&msgR, "Send")
+			}
+			if err != nil {
+				fmt.Println("Error writing to CSV:", err)
+			}
+			sim.Delay(10*time.Millisecond, func() {
+				if push {
+					wgGossip.Add(1)
+					sim.Go(func() { sender.Net.Send(sender, receiver, msgS, wgGossip) })
+				}
+				if reply {
+					wgGossip.Add(1)
+					sim.Go(func() { receiver.Net.Send(receiver, sender, msgR, wgGossip) })
+				}
+			})
+		})
+	}
+
+}
+
+// pullHandler answers a pull request with the node's rumor if the digest of
+// the request lacks something the node holds. Other messages are handled as
+// by DefaultHandler.
+type pullHandler struct {
+	node.DefaultHandler
+	nodes []*node.Node
+}
+
+func (h pullHandler) HandleMessage(n *node.Node, msg node.Message) {
+	if msg.Type != node.TypePullRequest {
+		h.DefaultHandler.HandleMessage(n, msg)
+		return
+	}
+	n.Reply(msg)
+	if msg.Status == node.Corrupted || !n.Missing(msg) {
+		return // сводка повреждена или у запросившего уже всё есть
+	}
+	if err := n.Send(h.nodes[msg.SenderID], n.Rumor()); err != nil {
+		fmt.Println("Error sending message:", err)
+	}
+}
+
+// drainReplies empties a reply channel. A node may get more replies in a
+// round than it reads, and a full channel would block the replying nodes.
+func drainReplies(ch chan node.Message) {
+	for {
+		select {
+		case resp := <-ch:
+			flags.VPrintln("Got response:", resp)
+		default:
+			return
 		}
-		wgGossip.Add(2)
-		go simulator.Send(sender, receiver, msgS, wgGossip)
-		go simulator.Send(receiver, sender, msgR, wgGossip)
 	}
+}
 
+// selectPeer picks the gossip target from the partial view of the node, or
+// from all its Peers without a peer sampling protocol. With -locality and
+// node coordinates nearby candidates are preferred.
+func selectPeer(n *node.Node, r rng.Source) *node.Node {
+	peers := n.Peers
+	if membership.Enabled() {
+		peers = membership.View(n)
+	}
+	if flags.Exper.Locality > 0 && n.Coord != nil {
+		return nearbyPeer(n, peers, r)
+	}
+	return getRandomPeer(n, peers, r)
 }
 
-func getRandomPeer(n *node.Node) *node.Node {
-	if len(n.Peers) == 0 {
+// getRandomPeer picks a candidate other than the node itself uniformly, or
+// returns nil when there is none.
+func getRandomPeer(n *node.Node, peers []*node.Node, r rng.Source) *node.Node {
+	others := make([]*node.Node, 0, len(peers))
+	for _, p := range peers {
+		if p.ID != n.ID {
+			others = append(others, p)
+		}
+	}
+	if len(others) == 0 {
 		return nil
 	}
-	for {
-		p := n.Peers[rand.Intn(len(n.Peers))]
+	return others[r.Intn(len(others))]
+}
+
+// nearbyPeer picks a candidate with probability proportional to
+// 1/(1+d)^locality, where d is its distance in ms.
+func nearbyPeer(n *node.Node, peers []*node.Node, r rng.Source) *node.Node {
+	weights := make([]float64, len(peers))
+	total := 0.0
+	for i, p := range peers {
 		if p.ID != n.ID {
-			return p
+			weights[i] = math.Pow(1+coords.Distance(n.Coord, p.Coord), -flags.Exper.Locality)
+			total += weights[i]
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	u := r.Float64() * total
+	for i, w := range weights {
+		if u < w {
+			return peers[i]
+		}
+		u -= w
+	}
+	// погрешность округления: берём последнего подходящего кандидата
+	for i := len(peers) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return peers[i]
 		}
 	}
+	return nil
 }
 
 func printResult(nodes []*node.Node) {
@@ -173,8 +279,8 @@ func printResult(nodes []*node.Node) {
 	}
 	fmt.Println("========== Gossip Result ==========")
 	for _, n := range nodes {
-		if n.DB.Data != "" {
-			fmt.Println("Node", n.ID, "received message:", n.DB.Data)
+		if data := n.Stored().Data; data != "" {
+			fmt.Println("Node", n.ID, "received message:", data)
 		} else {
 			fmt.Println("Node", n.ID, "did not receive any message")
 		}
@@ -183,44 +289,71 @@ func printResult(nodes []*node.Node) {
 }
 
 func gossipFinished(nodes []*node.Node, round int) bool {
-	// Count how many nodes received the message
+	// Count how many nodes received the message; crashed nodes neither count nor are waited for
 	receivedCount := 0
 	alive := 0
 	for _, n := range nodes {
-		flags.VPrintf("----- Node %d received message: %s\n", n.ID, n.DB.Data)
-		if n.DB.Data == "OK" || n.DB.Data == "corrupted" {
+		data := n.Stored().Data
+		flags.VPrintf("----- Node %d received message: %s\n", n.ID, data)
+		if data == "OK" && !n.Crashed() {
 			receivedCount++
 		}
-		if n.Alive {
+		if n.IsAlive() {
 			alive++
 		}
 	}
 
 	fmt.Println("==========================Round:", round, "| Informed nodes:", receivedCount, "/", alive, "Alives")
 
-	return receivedCount >= alive
+	if receivedCount == 0 && alive > 0 && !churn.RecoveryPending() {
+		// все узлы с сообщением упали навсегда, распространять больше некому
+		fmt.Println("The rumor died out: every node holding the message has crashed")
+		return true
+	}
+	if receivedCount < alive && workload.Done() && !churn.RecoveryPending() {
+		if reachable := reachableAlive(nodes); receivedCount >= reachable {
+			// в неполном графе часть живых узлов может быть отрезана
+			fmt.Println("The rumor cannot spread further:", alive-reachable, "alive nodes are unreachable")
+			return true
+		}
+	}
+	// при обновлениях ключей ждём, пока все записи сделаны и дошли до всех живых узлов
+	return receivedCount >= alive && workload.Done() && node.Converged(nodes)
 }
 
-func openCSV(nodes []*node.Node) ([]*node.SafeWriter, []*os.File) {
-	var writers = make([]*node.SafeWriter, len(nodes))
-	var csvFiles = make([]*os.File, len(nodes))
-	for i, sender := range nodes {
-		file, err := os.OpenFile("metrics/metrics_node_sender"+fmt.Sprintf("%d", sender.ID)+".csv", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			fmt.Println("Error opening CSV file:", err)
-			return nil, nil
+// reachableAlive counts the alive nodes connected through alive nodes to a
+// node that holds the message. With partial views the nodes are connected
+// through the views rather than the Peers.
+func reachableAlive(nodes []*node.Node) int {
+	known := membership.Known()
+	seen := make(map[int]bool)
+	var queue []*node.Node
+	for _, n := range nodes {
+		if n.Stored().Data == "OK" && n.IsAlive() {
+			seen[n.ID] = true
+			queue = append(queue, n)
 		}
-		// Add header if file is empty
-		info, _ := file.Stat()
-		if info.Size() == 0 {
-			w := csv.NewWriter(file)
-			w.Write([]string{"Experiment ID", "Time", "Node ID", "Alive Node", "Sender ID", "Receiver ID", "Messages Data", "Message ID", "Node DB", "Message Type"})
-			w.Flush()
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, p := range neighbours(n, nodes, known) {
+			if !seen[p.ID] && p.IsAlive() {
+				seen[p.ID] = true
+				queue = append(queue, p)
+			}
 		}
-
-		writers[i] = &node.SafeWriter{Writer: csv.NewWriter(file)}
-		csvFiles[i] = file
 	}
+	return len(seen)
+}
 
-	return writers, csvFiles
+func neighbours(n *node.Node, nodes []*node.Node, known [][]int) []*node.Node {
+	if known == nil {
+		return n.Peers
+	}
+	peers := make([]*node.Node, 0, len(known[n.ID]))
+	for _, id := range known[n.ID] {
+		peers = append(peers, nodes[id])
+	}
+	return peers
 }
@@ -1,26 +1,66 @@
 package dissemination
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
+	"slices"
 	"strings"
-	"sync"
 
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/analyze"
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/metrics"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+	"github.com/fatih/color"
 )
 
-func Multicast(nodes []*node.Node, simulator *network.Simulator, multicastDomains int, ready chan bool) {
-	var senders = make([]*node.Node, multicastDomains)
+// Multicast sends the message from node 0 down a multicast tree. Without a
+// tree depth and branching the tree has two levels: node 0 and one sender
+// per domain. Otherwise it is a k-ary tree, see TreeShape.
+func Multicast(nodes []*node.Node, simulator *network.Simulator, multicastDomains, depth, branching int, ready chan bool) {
+	var root *node.Node
+	if depth == 0 && branching == 0 {
+		if multicastDomains < 2 {
+			fmt.Println("Error: need at least 2 multicast domains")
+			return
+		}
+		root = domainTree(nodes, multicastDomains)
+	} else {
+		var err error
+		depth, branching, err = TreeShape(len(nodes), depth, branching)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		root = karyTree(nodes, branching)
+		analyze.Summary.Rounds = depth // каждый уровень дерева — одна пересылка
+	}
+	root.Originate(node.NewMessage(root.ID, 0, "OK")) // инициализируем базу данных корня
+
+	resetMsgID()
 
-	if multicastDomains < 2 {
-		fmt.Println("Error: need at least 2 multicast domains")
-		return
+	metrics.AddExperimentStartTime()
+
+	// Отправляем сообщения от корня его детям
+	for _, child := range root.Peers {
+		msg := root.Rumor()
+		msg.MessageID = nextMsgID()
+		if err := root.Send(child, msg); err != nil {
+			fmt.Println("Error sending message:", err)
+		}
 	}
 
+	fmt.Println("Waiting for multicast messages to be sent...")
+	sim.Wait(root.Pending) // ждём, пока сообщения пройдут по всем уровням
+
+	ready <- true // сигнализируем, что сообщение отправлено
+}
+
+// domainTree builds the two-level tree: node 0 sends to the first node of
+// every other domain, which forwards the message to the rest of its domain.
+func domainTree(nodes []*node.Node, multicastDomains int) *node.Node {
+	var senders = make([]*node.Node, multicastDomains)
+
 	var i int
 	for i = range multicastDomains {
 		senders[i] = nodes[i]
@@ -28,59 +68,104 @@ func Multicast(nodes []*node.Node, simulator *network.Simulator, multicastDomain
 	}
 
 	senders[0].Peers = append(senders[0].Peers, senders[1:]...) // первый узел получает всех остальных в пирах
-	senders[0].DB = node.Message{Data: "OK"}                    // инициализируем базу данных первого узла
-	var j int = 0
 	for i = i + 1; i < len(nodes); i++ {
+		j := network.DomainOf(nodes[i].ID, multicastDomains)
 		senders[j].Peers = append(senders[j].Peers, nodes[i])
-		j = (j + 1) % multicastDomains
 	}
 
 	flags.VPrintln(PrintSenderPeers(senders))
 
-	// Открываем CSV файлы для каждого узла
-	var writers = make([]*node.SafeWriter, len(senders))
-	var csvFiles = make([]*os.File, len(senders))
-	var err error
-	for i, sender := range senders {
-		csvFiles[i], err = os.OpenFile("metrics/metrics_node_"+fmt.Sprintf("%d", sender.ID)+".csv", os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			fmt.Println("Error opening CSV file:", err)
-			return
-		}
-		writers[i] = &node.SafeWriter{Writer: csv.NewWriter(csvFiles[i])}
+	// отправитель домена пересылает полученное сообщение своим пирам
+	for _, sender := range senders[1:] {
+		sender.Handler = treeHandler{children: sender.Peers}
 	}
+	return senders[0]
+}
 
-	var wgMultiCast sync.WaitGroup
-	resetMsgID()
-	msgData := "OK"
+// karyTree lays the nodes out as a k-ary heap: the children of node i are
+// nodes k*i+1 ... k*i+k. Every inner node except the root forwards the
+// message to its children.
+func karyTree(nodes []*node.Node, branching int) *node.Node {
+	var inner []*node.Node
+	for i, n := range nodes {
+		first := branching*i + 1
+		if first >= len(nodes) {
+			break // дальше только листья
+		}
+		n.Peers = slices.Clone(nodes[first:min(first+branching, len(nodes))])
+		if i > 0 {
+			n.Handler = treeHandler{children: n.Peers}
+		}
+		inner = append(inner, n)
+	}
 
-	metrics.AddExperimentStartTime()
+	flags.VPrintln(PrintSenderPeers(inner))
+	return nodes[0]
+}
 
-	// Отправляем сообщения от стартового узла
-	wgMultiCast.Add(1)
-	responses := make([]string, len(senders)-1) // инициализируем слайс для ответов
-	responses = BroadcastFromNode(senders[0], simulator, writers[0], &wgMultiCast, nextMsgID, msgData)
-	responses = append([]string{"Root_sender"}, responses...) // добавляем ответ от первого узла
-	wgMultiCast.Wait()
-
-	for k, sender := range senders[1:] { // начинаем с 1, т.к. 0 уже отправил сообщения
-		wgMultiCast.Add(1)
-		fmt.Println(responses)
-		fmt.Println("k:", k+1, "Sender ID:", sender.ID)
-		BroadcastFromNode(sender, simulator, writers[k+1], &wgMultiCast, nextMsgID, responses[k+1])
+// TreeShape completes the shape of a k-ary multicast tree over n nodes.
+// With only the branching the tree is as shallow as the branching allows;
+// with only the depth the branching is the smallest that fits all nodes
+// within that depth. The returned depth is the height of the built tree.
+func TreeShape(n, depth, branching int) (int, int, error) {
+	if depth < 0 || branching < 0 {
+		return 0, 0, fmt.Errorf("tree depth and branching must not be negative")
+	}
+	if depth == 0 && branching == 0 {
+		return 0, 0, nil // двухуровневое дерево по доменам
+	}
+	if branching == 0 {
+		branching = 1
+		for treeSize(branching, depth, n) < n {
+			branching++
+		}
+	}
+	if depth > 0 && treeSize(branching, depth, n) < n {
+		return 0, 0, fmt.Errorf("a tree of depth %d and branching %d holds only %d of %d nodes",
+			depth, branching, treeSize(branching, depth, n), n)
+	}
+	depth = 0
+	for treeSize(branching, depth, n) < n {
+		depth++
 	}
+	return depth, branching, nil
+}
 
-	fmt.Println("Waiting for multicast messages to be sent...")
-	wgMultiCast.Wait() // ждём, пока все сообщения будут отправлены
-	fmt.Println("All multicast messages sent, flushing CSV files...")
-	for i := range writers {
-		writers[i].Mutex.Lock()
-		writers[i].Writer.Flush()
-		writers[i].Mutex.Unlock()
-		csvFiles[i].Close()
+// treeSize is the number of nodes of a full k-ary tree of the given depth,
+// capped at limit.
+func treeSize(branching, depth, limit int) int {
+	size, level := 1, 1
+	for range depth {
+		level *= branching
+		size += level
+		if size >= limit {
+			return limit
+		}
 	}
+	return size
+}
 
-	ready <- true // сигнализируем, что сообщение отправлено
+// treeHandler forwards a newly stored message to the node's children in the multicast tree.
+type treeHandler struct {
+	node.DefaultHandler
+	children []*node.Node
+}
+
+func (h treeHandler) HandleMessage(n *node.Node, msg node.Message) {
+	accepted := h.Accept(n, msg)
+	n.Reply(msg)
+	if !accepted {
+		return // отправитель домена не получил целое сообщение, рассылать нечего
+	}
+	color.HiMagenta("Broadcasting message from node " + fmt.Sprintf("%d", n.ID))
+	for _, child := range h.children {
+		forward := n.Rumor()
+		forward.MessageID = nextMsgID()
+		if err := n.Send(child, forward); err != nil {
+			fmt.Println("Error sending message:", err)
+			return
+		}
+	}
 }
 
 func PrintSenderPeers(senders []*node.Node) string {
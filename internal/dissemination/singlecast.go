@@ -1,72 +1,62 @@
 package dissemination
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
-	"sync"
-	"time"
 
 	"github.com/Tarat0r/distributed-systems-modeling/internal/metrics"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
 )
 
-func Singlecast(nodes []*node.Node, simulator *network.Simulator, ready chan bool) {
-	var wg sync.WaitGroup
-	start := nodes[0] // стартовый узел
-
-	start.DB = node.Message{Data: "OK"}
+// chainHandler passes the message along the chain: a node that stores a new
+// message forwards it to the next node. A lost, corrupted or rejected message
+// stops the chain.
+type chainHandler struct {
+	node.DefaultHandler
+	next *node.Node
+}
 
-	csvFile, err := os.OpenFile("metrics/metrics_node_"+fmt.Sprintf("%d", start.ID)+".csv", os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Println("Error opening CSV file:", err)
+func (h chainHandler) HandleMessage(n *node.Node, msg node.Message) {
+	accepted := h.Accept(n, msg)
+	n.Reply(msg)
+	if !accepted {
+		fmt.Println("Node", n.ID, "did not accept the message, the chain stops")
 		return
 	}
-	writer := &node.SafeWriter{}
-	writer.Writer = csv.NewWriter(csvFile)
-	defer csvFile.Close()
-
-	metrics.AddExperimentStartTime()
+	if h.next == nil {
+		return // последний узел цепочки
+	}
+	forward := n.Rumor() // каждый узел пересылает то, что сохранил сам
+	forward.MessageID++
+	if err := n.Send(h.next, forward); err != nil {
+		fmt.Println("Error sending message:", err)
+	}
+}
 
-	msgID := 1
-	msgData := "OK"
-outer:
-	for j, sender := range nodes {
-		if sender.ID == len(nodes)-1 {
-			continue // пропускаем последний узел, чтобы не отправлять ему сообщение
-		}
-		respChan := make(chan node.Message)
-		msg := node.Message{
-			SenderID:     sender.ID,
-			Data:         msgData,
-			MessageID:    msgID,
-			ResponseChan: respChan,
-		}
-		msgID++
-		reciver := nodes[j+1]
+func Singlecast(nodes []*node.Node, simulator *network.Simulator, ready chan bool) {
+	start := nodes[0] // стартовый узел
 
-		wg.Add(1)
-		go simulator.Send(sender, reciver, msg, &wg)
+	start.Originate(node.NewMessage(start.ID, 0, "OK"))
 
-		err = node.WriteToCSV(writer, reciver, &msg, "Send") // Записываем в CSV
-		if err != nil {
-			fmt.Println("Error writing to CSV:", err)
-			return
+	for j, n := range nodes {
+		h := chainHandler{}
+		if j+1 < len(nodes) {
+			h.next = nodes[j+1]
 		}
+		n.Handler = h
+	}
 
-		select {
-		case resp := <-respChan:
-			fmt.Println("Got response:", resp)
-			if resp.Data == "corrupted" {
-				msgData = "corrupted" // если сообщение повреждено, меняем данные сообщения
-			}
+	metrics.AddExperimentStartTime()
 
-		case <-time.After(50 * time.Millisecond): // ждем ответа 50 мс
-			fmt.Println("Timeout waiting for node", reciver.ID)
-			break outer
+	if len(nodes) > 1 {
+		msg := start.Rumor()
+		msg.MessageID = 1
+		if err := start.Send(nodes[1], msg); err != nil {
+			fmt.Println("Error sending message:", err)
 		}
 	}
-	wg.Wait()     // ждем завершения всех горутин
-	ready <- true // сигнализируем, что сообщение отправлено
+
+	sim.Wait(start.Pending) // ждём, пока сообщение пройдёт по цепочке
+	ready <- true           // сигнализируем, что сообщение отправлено
 }
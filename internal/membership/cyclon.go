@@ -0,0 +1,58 @@
+package membership
+
+// cyclonShuffle ages the view of node p and swaps up to Shuffle entries with
+// the oldest member q. The entry of q is dropped before the exchange: if q
+// is down or the message is lost, q stays out of the view.
+func (r *run) cyclonShuffle(p int) {
+	v := r.views[p]
+	if len(v.active) == 0 {
+		return
+	}
+	oldest := 0
+	for i := range v.active {
+		v.active[i].age++
+		if v.active[i].age > v.active[oldest].age {
+			oldest = i
+		}
+	}
+	q := v.active[oldest].id
+	v.remove(q)
+
+	// p отправляет свежую запись о себе и Shuffle-1 случайных соседей
+	sent := append([]entry{{id: p}}, r.sample(v, r.m.Shuffle-1, -1)...)
+	if !r.send(p, q) {
+		return
+	}
+	reply := r.sample(r.views[q], r.m.Shuffle, -1)
+	r.integrate(q, sent, reply)
+	if !r.send(q, p) {
+		return
+	}
+	r.integrate(p, reply, sent)
+}
+
+// integrate adds the received entries to the view of node id. Entries
+// pointing to the node itself or already known are skipped; when the view
+// is full an entry the node has just sent away makes room.
+func (r *run) integrate(id int, received, sent []entry) {
+	v := r.views[id]
+	for _, e := range received {
+		if e.id == id || v.inActive(e.id) {
+			continue
+		}
+		if len(v.active) >= r.m.ViewSize {
+			replaced := false
+			for len(sent) > 0 && !replaced {
+				if v.inActive(sent[0].id) {
+					v.remove(sent[0].id)
+					replaced = true
+				}
+				sent = sent[1:]
+			}
+			if !replaced {
+				continue
+			}
+		}
+		v.active = append(v.active, e)
+	}
+}
@@ -0,0 +1,117 @@
+package membership
+
+// repair drops the members of the active view of node p that are down or no
+// longer hold p in their own active view (the connection was closed while
+// p was down or the disconnect was lost) and fills the free slots from the
+// passive view. A NEIGHBOR request is accepted
+// if the candidate has room, or always when p has no active member left; a
+// full candidate then disconnects a random member of its own.
+func (r *run) repair(p int) {
+	v := r.views[p]
+	for _, e := range append([]entry(nil), v.active...) {
+		if !r.nodes[e.id].IsAlive() || !r.views[e.id].inActive(p) {
+			v.remove(e.id) // обрыв соединения замечается сразу
+		}
+	}
+	for _, c := range r.shuffled(v.passive) {
+		if len(v.active) >= r.m.ViewSize {
+			return
+		}
+		priority := len(v.active) == 0
+		if !r.send(p, c) {
+			v.removePassive(c) // кандидат не ответил
+			continue
+		}
+		cv := r.views[c]
+		if cv.inActive(p) {
+			// c не узнал о разрыве: связь восстанавливается без вытеснения
+			v.removePassive(c)
+			v.active = append(v.active, entry{id: c})
+			r.send(c, p)
+			continue
+		}
+		if len(cv.active) >= r.m.ViewSize && !priority {
+			r.send(c, p) // отказ
+			continue
+		}
+		if len(cv.active) >= r.m.ViewSize {
+			d := cv.active[r.rs.Intn(len(cv.active))].id
+			r.disconnect(c, d)
+		}
+		v.removePassive(c)
+		cv.removePassive(p)
+		v.active = append(v.active, entry{id: c})
+		cv.active = append(cv.active, entry{id: p})
+		r.send(c, p) // согласие
+	}
+}
+
+// disconnect removes the active link between a and b; both keep each other
+// as backups in their passive views.
+func (r *run) disconnect(a, b int) {
+	r.views[a].remove(b)
+	r.addPassive(a, b, nil)
+	if r.send(a, b) {
+		r.views[b].remove(a)
+		r.addPassive(b, a, nil)
+	}
+}
+
+// passiveShuffle sends node p, a few active and a few passive members to a
+// random active member q, which answers with as many members of its passive
+// view. Both add what they receive to their passive views.
+func (r *run) passiveShuffle(p int) {
+	v := r.views[p]
+	if len(v.active) == 0 {
+		return
+	}
+	q := v.active[r.rs.Intn(len(v.active))].id
+	sent := []int{p}
+	for _, e := range r.sample(v, r.m.Shuffle/2, q) {
+		sent = append(sent, e.id)
+	}
+	for _, id := range r.shuffled(v.passive) {
+		if len(sent) >= r.m.Shuffle {
+			break
+		}
+		sent = append(sent, id)
+	}
+	if !r.send(p, q) {
+		return
+	}
+	qv := r.views[q]
+	reply := r.shuffled(qv.passive)[:min(len(sent), len(qv.passive))]
+	for _, id := range sent {
+		r.addPassive(q, id, reply)
+	}
+	if !r.send(q, p) {
+		return
+	}
+	for _, id := range reply {
+		r.addPassive(p, id, sent)
+	}
+}
+
+// addPassive adds a node to the passive view of node id unless it is the
+// node itself or already known. A full view first evicts a node it has just
+// sent away, otherwise a random one.
+func (r *run) addPassive(id, add int, sent []int) {
+	v := r.views[id]
+	if add == id || v.inActive(add) || v.inPassive(add) {
+		return
+	}
+	if len(v.passive) >= r.m.PassiveSize {
+		evicted := false
+		for _, s := range sent {
+			if v.inPassive(s) {
+				v.removePassive(s)
+				evicted = true
+				break
+			}
+		}
+		if !evicted {
+			v.removePassive(v.passive[r.rs.Intn(len(v.passive))])
+		}
+	}
+	v.passive = append(v.passive, add)
+}
@@ -0,0 +1,341 @@
+// Package membership is a peer sampling service: instead of knowing every
+// other node, each node keeps a small partial view of the cluster that
+// evolves while gossip runs, and gossip picks its targets from that view.
+//
+// Two protocols are supported. Cyclon keeps one view of bounded size; every
+// round a node swaps a few entries with the oldest member of its view, which
+// is dropped if it does not answer. HyParView keeps a small symmetric active
+// view used for gossip and a larger passive view of backups; members that
+// fail are replaced from the passive view, and the passive views are
+// refreshed by shuffles.
+//
+// Views are bootstrapped from the Peers of the topology and exchanged once
+// per gossip round. The exchanges go through the network: crashed nodes do
+// not answer, and partitions and link loss drop the membership messages.
+package membership
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+)
+
+// Supported protocols.
+const (
+	Full      = "full" // каждый узел знает всех своих Peers
+	Cyclon    = "cyclon"
+	HyParView = "hyparview"
+)
+
+// Network decides whether a membership message gets through.
+type Network interface {
+	Delivers(from, to int, r rng.Source) bool
+}
+
+// Model describes the peer sampling of one experiment.
+type Model struct {
+	Protocol    string
+	ViewSize    int // размер представления Cyclon или активного представления HyParView
+	Shuffle     int // записей в одном обмене
+	PassiveSize int // размер пассивного представления HyParView
+	Seed        int64
+}
+
+// Stats summarizes the membership of a finished simulation.
+type Stats struct {
+	Messages    int     // отправленные сообщения протокола
+	AvgViewSize float64 // средний размер представления живых узлов в конце
+	MaxInDegree int     // наибольшее число представлений живых узлов, в которых есть один узел
+}
+
+var (
+	mu      sync.Mutex
+	model   *Model
+	current *run
+)
+
+// entry is a member of a view; the age counts the rounds since the entry
+// was created by its node and is used by Cyclon only.
+type entry struct {
+	id  int
+	age int
+}
+
+type view struct {
+	active  []entry
+	passive []int // только HyParView
+}
+
+// run is the membership of the running simulation.
+type run struct {
+	mu       sync.Mutex
+	m        *Model
+	nodes    []*node.Node
+	net      Network
+	rs       *rng.Stream
+	views    []*view
+	messages int
+}
+
+// Configure checks the peer sampling parameters. With -membership full
+// gossip picks from all the Peers of a node, as before.
+func Configure(exper flags.Experiment) error {
+	switch exper.Membership {
+	case Full, Cyclon, HyParView:
+	default:
+		return fmt.Errorf("unknown membership protocol %q (full, cyclon or hyparview)", exper.Membership)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	model = nil
+	if exper.Membership == Full {
+		return nil
+	}
+	if exper.ViewSize < 1 {
+		return fmt.Errorf("view size must be at least 1")
+	}
+	if exper.ShuffleLength < 1 {
+		return fmt.Errorf("shuffle length must be at least 1")
+	}
+	if exper.Membership == HyParView && exper.PassiveViewSize < 1 {
+		return fmt.Errorf("passive view size must be at least 1")
+	}
+	model = &Model{
+		Protocol:    exper.Membership,
+		ViewSize:    exper.ViewSize,
+		Shuffle:     min(exper.ShuffleLength, exper.ViewSize),
+		PassiveSize: exper.PassiveViewSize,
+		Seed:        exper.Seed,
+	}
+	return nil
+}
+
+// Enabled reports whether gossip uses partial views.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return model != nil
+}
+
+// Start bootstraps the views of a new simulation from the Peers of the
+// nodes. Every simulation starts from the same views.
+func Start(nodes []*node.Node, net Network) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = nil
+	if model == nil {
+		return
+	}
+	r := &run{
+		m:     model,
+		nodes: nodes,
+		net:   net,
+		rs:    rng.New(model.Seed, "membership"),
+		views: make([]*view, len(nodes)),
+	}
+	for i := range r.views {
+		r.views[i] = &view{}
+	}
+	for _, n := range nodes {
+		candidates := r.shuffled(peerIDs(n))
+		v := r.views[n.ID]
+		for _, id := range candidates {
+			switch {
+			case r.m.Protocol == Cyclon && len(v.active) < r.m.ViewSize:
+				v.active = append(v.active, entry{id: id})
+			case r.m.Protocol == HyParView && len(v.active) < r.m.ViewSize &&
+				len(r.views[id].active) < r.m.ViewSize && !v.inActive(id):
+				// активные представления HyParView симметричны
+				v.active = append(v.active, entry{id: id})
+				r.views[id].active = append(r.views[id].active, entry{id: n.ID})
+			case r.m.Protocol == HyParView && !v.inActive(id):
+				r.addPassive(n.ID, id, nil)
+			}
+		}
+	}
+	current = r
+}
+
+// Stop ends the membership of the simulation and returns its statistics;
+// without partial views the statistics are zero.
+func Stop() Stats {
+	mu.Lock()
+	r := current
+	current = nil
+	mu.Unlock()
+	if r == nil {
+		return Stats{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := Stats{Messages: r.messages}
+	inDegree := make(map[int]int)
+	alive := 0
+	for _, n := range r.nodes {
+		if !n.IsAlive() {
+			continue
+		}
+		alive++
+		stats.AvgViewSize += float64(len(r.views[n.ID].active))
+		for _, e := range r.views[n.ID].active {
+			inDegree[e.id]++
+			stats.MaxInDegree = max(stats.MaxInDegree, inDegree[e.id])
+		}
+	}
+	if alive > 0 {
+		stats.AvgViewSize /= float64(alive)
+	}
+	return stats
+}
+
+// Round runs one exchange of every alive node, in the order of node IDs.
+func Round() {
+	r := active()
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, n := range r.nodes {
+		if !n.IsAlive() {
+			continue
+		}
+		if r.m.Protocol == Cyclon {
+			r.cyclonShuffle(n.ID)
+		} else {
+			r.repair(n.ID)
+			r.passiveShuffle(n.ID)
+		}
+	}
+}
+
+// View returns the members of the view of the node that gossip picks its
+// targets from: the Cyclon view or the HyParView active view.
+func View(n *node.Node) []*node.Node {
+	r := active()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := r.views[n.ID]
+	peers := make([]*node.Node, 0, len(v.active))
+	for _, e := range v.active {
+		peers = append(peers, r.nodes[e.id])
+	}
+	return peers
+}
+
+// Known returns, for every node, the nodes it knows of or that know of it:
+// the members of both views in either direction. A node outside this graph
+// cannot learn anything by gossip until the views change.
+func Known() [][]int {
+	r := active()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	adj := make([][]int, len(r.nodes))
+	for i, v := range r.views {
+		for _, e := range v.active {
+			adj[i] = append(adj[i], e.id)
+			adj[e.id] = append(adj[e.id], i)
+		}
+		for _, id := range v.passive {
+			adj[i] = append(adj[i], id)
+			adj[id] = append(adj[id], i)
+		}
+	}
+	return adj
+}
+
+func active() *run {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// send counts a membership message and reports whether it arrived.
+func (r *run) send(from, to int) bool {
+	r.messages++
+	return r.nodes[to].IsAlive() && r.net.Delivers(from, to, r.rs)
+}
+
+// shuffled returns the IDs in random order.
+func (r *run) shuffled(ids []int) []int {
+	ids = append([]int(nil), ids...)
+	for i := len(ids) - 1; i > 0; i-- {
+		j := r.rs.Intn(i + 1)
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids
+}
+
+func peerIDs(n *node.Node) []int {
+	ids := make([]int, 0, len(n.Peers))
+	for _, p := range n.Peers {
+		if p.ID != n.ID {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+func (v *view) inActive(id int) bool {
+	return v.find(id) >= 0
+}
+
+func (v *view) find(id int) int {
+	for i, e := range v.active {
+		if e.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v *view) remove(id int) {
+	if i := v.find(id); i >= 0 {
+		v.active = append(v.active[:i], v.active[i+1:]...)
+	}
+}
+
+func (v *view) inPassive(id int) bool {
+	for _, p := range v.passive {
+		if p == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *view) removePassive(id int) {
+	for i, p := range v.passive {
+		if p == id {
+			v.passive = append(v.passive[:i], v.passive[i+1:]...)
+			return
+		}
+	}
+}
+
+// sample picks up to k random members of the active view except one node.
+func (r *run) sample(v *view, k, except int) []entry {
+	var ids []int
+	for _, e := range v.active {
+		if e.id != except {
+			ids = append(ids, e.id)
+		}
+	}
+	ids = r.shuffled(ids)
+	out := make([]entry, 0, min(k, len(ids)))
+	for _, id := range ids[:min(k, len(ids))] {
+		out = append(out, v.active[v.find(id)])
+	}
+	return out
+}
@@ -8,9 +8,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -76,13 +76,23 @@ func createTable(db *sql.DB, tableName string) {
 	MessagesData  TEXT,
 	MessageID     INTEGER,
 	NodeDB        TEXT,
-	MessageType   TEXT
+	MessageType   TEXT,
+	Lamport       INTEGER,
+	MsgLamport    INTEGER,
+	VectorClock   TEXT,
+	MsgVector     TEXT
 	);
 	`
 	_, err := db.Exec(sqlStmt)
 	if err != nil {
 		log.Fatal(err)
 	}
+	AddMissingColumns(db, tableName, []Column{
+		{Name: "Lamport", Type: "INTEGER"},
+		{Name: "MsgLamport", Type: "INTEGER"},
+		{Name: "VectorClock", Type: "TEXT"},
+		{Name: "MsgVector", Type: "TEXT"},
+	})
 	flags.VPrintln("Table", tableName, "created successfully")
 
 }
@@ -93,9 +103,11 @@ func writeCSVtoDB(db *sql.DB, tableName string, records [][]string) {
 			continue // Skip header row
 		}
 		_, err := db.Exec(`INSERT INTO `+tableName+` (
-			ExperimentID, Time, NodeID, AliveNode, SenderID, ReceiverID, MessagesData, MessageID, NodeDB, MessageType) 
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?
-			)`, row[0], row[1], row[2], row[3], row[4], row[5], row[6], row[7], row[8], row[9])
+			ExperimentID, Time, NodeID, AliveNode, SenderID, ReceiverID, MessagesData, MessageID, NodeDB, MessageType,
+			Lamport, MsgLamport, VectorClock, MsgVector) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+			)`, row[0], row[1], row[2], row[3], row[4], row[5], row[6], row[7], row[8], row[9],
+			row[10], row[11], row[12], row[13])
 		if err != nil {
 			log.Printf("Insert failed at row %d: %v", i, err)
 		}
@@ -170,7 +182,7 @@ func RemoveDB() error {
 }
 
 func AddExperimentStartTime() {
-	ExperimentStartTime = time.Now().Format("2006-01-02 15:04:05.000000000")
+	ExperimentStartTime = sim.Now().Format("2006-01-02 15:04:05.000000000")
 	flags.VPrintln("Added start time for experiment:", ExperimentStartTime)
 }
 
@@ -203,12 +215,144 @@ func WriteExperimentToDB() {
     DelayMean             INTEGER,
     AliveProbability      REAL,
     LossProbability       REAL,
-    CorruptionProbability REAL
+    CorruptionProbability REAL,
+    Seed                  INTEGER,
+    VirtualTime           BOOLEAN,
+    DelayDistribution     TEXT,
+    DelayStdDev           REAL,
+    DelayShape            REAL,
+    LinkModel             TEXT,
+    InterDelayMean        REAL,
+    InterLoss             REAL,
+    InterCorruption       REAL,
+    LinkFile              TEXT,
+    LossModel             TEXT,
+    GEGoodToBad           REAL,
+    GEBadToGood           REAL,
+    GELossGood            REAL,
+    GELossBad             REAL,
+    Partitions            TEXT,
+    MessageSize           INTEGER,
+    UplinkMbps            REAL,
+    DownlinkMbps          REAL,
+    DuplicateProbability REAL,
+    ReorderProbability    REAL,
+    ReorderWindow         REAL,
+    Checksum              BOOLEAN,
+    ChurnMTTF             REAL,
+    ChurnMTTR             REAL,
+    ChurnDistribution     TEXT,
+    ChurnSchedule         TEXT,
+    ByzantineFraction     REAL,
+    ByzantineIDs          TEXT,
+    ByzantineBehavior     TEXT,
+    ByzantineTolerance    INTEGER,
+    Keys                  INTEGER,
+    Updates               INTEGER,
+    UpdateInterval        REAL,
+    VectorClocks          BOOLEAN,
+    CrashState            TEXT,
+    SnapshotInterval      REAL,
+    Reliable              BOOLEAN,
+    Retries               INTEGER,
+    AckTimeout            REAL,
+    Backoff               REAL,
+    Transport             TEXT,
+    ProcessingTime        REAL,
+    ProcessingDist        TEXT,
+    ProcessingSpread      REAL,
+    ProcessingShape       REAL,
+    InboxCapacity         INTEGER,
+    Overflow              TEXT,
+    Topology              TEXT,
+    TopologyDegree        INTEGER,
+    TopologyProb          REAL,
+    TopologyFile          TEXT,
+    Membership            TEXT,
+    ViewSize              INTEGER,
+    ShuffleLength         INTEGER,
+    PassiveViewSize       INTEGER,
+    TreeDepth             INTEGER,
+    TreeBranching         INTEGER,
+    Coords                TEXT,
+    CoordDims             INTEGER,
+    CoordSize             REAL,
+    CoordSpread           REAL,
+    CoordFile             TEXT,
+    Jitter                REAL,
+    Locality              REAL
 );`
 	_, err = db.Exec(sqlStmt)
 	if err != nil {
 		log.Fatal(err)
 	}
+	AddMissingColumns(db, tableName, []Column{
+		{"Seed", "INTEGER"},
+		{"VirtualTime", "BOOLEAN"},
+		{"DelayDistribution", "TEXT"},
+		{"DelayStdDev", "REAL"},
+		{"DelayShape", "REAL"},
+		{"LinkModel", "TEXT"},
+		{"InterDelayMean", "REAL"},
+		{"InterLoss", "REAL"},
+		{"InterCorruption", "REAL"},
+		{"LinkFile", "TEXT"},
+		{"LossModel", "TEXT"},
+		{"GEGoodToBad", "REAL"},
+		{"GEBadToGood", "REAL"},
+		{"GELossGood", "REAL"},
+		{"GELossBad", "REAL"},
+		{"Partitions", "TEXT"},
+		{"MessageSize", "INTEGER"},
+		{"UplinkMbps", "REAL"},
+		{"DownlinkMbps", "REAL"},
+		{"DuplicateProbability", "REAL"},
+		{"ReorderProbability", "REAL"},
+		{"ReorderWindow", "REAL"},
+		{"Checksum", "BOOLEAN"},
+		{"ChurnMTTF", "REAL"},
+		{"ChurnMTTR", "REAL"},
+		{"ChurnDistribution", "TEXT"},
+		{"ChurnSchedule", "TEXT"},
+		{"ByzantineFraction", "REAL"},
+		{"ByzantineIDs", "TEXT"},
+		{"ByzantineBehavior", "TEXT"},
+		{"ByzantineTolerance", "INTEGER"},
+		{"Keys", "INTEGER"},
+		{"Updates", "INTEGER"},
+		{"UpdateInterval", "REAL"},
+		{"VectorClocks", "BOOLEAN"},
+		{"CrashState", "TEXT"},
+		{"SnapshotInterval", "REAL"},
+		{"Reliable", "BOOLEAN"},
+		{"Retries", "INTEGER"},
+		{"AckTimeout", "REAL"},
+		{"Backoff", "REAL"},
+		{"Transport", "TEXT"},
+		{"ProcessingTime", "REAL"},
+		{"ProcessingDist", "TEXT"},
+		{"ProcessingSpread", "REAL"},
+		{"ProcessingShape", "REAL"},
+		{"InboxCapacity", "INTEGER"},
+		{"Overflow", "TEXT"},
+		{"Topology", "TEXT"},
+		{"TopologyDegree", "INTEGER"},
+		{"TopologyProb", "REAL"},
+		{"TopologyFile", "TEXT"},
+		{"Membership", "TEXT"},
+		{"ViewSize", "INTEGER"},
+		{"ShuffleLength", "INTEGER"},
+		{"PassiveViewSize", "INTEGER"},
+		{"TreeDepth", "INTEGER"},
+		{"TreeBranching", "INTEGER"},
+		{"Coords", "TEXT"},
+		{"CoordDims", "INTEGER"},
+		{"CoordSize", "REAL"},
+		{"CoordSpread", "REAL"},
+		{"CoordFile", "TEXT"},
+		{"Jitter", "REAL"},
+		{"Locality", "REAL"},
+	})
 	flags.VPrintln("Table", tableName, "created successfully")
 
 	_, err = db.Exec(`INSERT INTO Experiments (
@@ -220,8 +364,73 @@ func WriteExperimentToDB() {
 		DelayMean,
 		AliveProbability,
 		LossProbability,
-		CorruptionProbability
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		CorruptionProbability,
+		Seed,
+		VirtualTime,
+		DelayDistribution,
+		DelayStdDev,
+		DelayShape,
+		LinkModel,
+		InterDelayMean,
+		InterLoss,
+		InterCorruption,
+		LinkFile,
+		LossModel,
+		GEGoodToBad,
+		GEBadToGood,
+		GELossGood,
+		GELossBad,
+		Partitions,
+		MessageSize,
+		UplinkMbps,
+		DownlinkMbps,
+		DuplicateProbability,
+		ReorderProbability,
+		ReorderWindow,
+		Checksum,
+		ChurnMTTF,
+		ChurnMTTR,
+		ChurnDistribution,
+		ChurnSchedule,
+		ByzantineFraction,
+		ByzantineIDs,
+		ByzantineBehavior,
+		ByzantineTolerance,
+		Keys,
+		Updates,
+		UpdateInterval,
+		VectorClocks,
+		CrashState,
+		SnapshotInterval,
+		Reliable,
+		Retries,
+		AckTimeout,
+		Backoff,
+		Transport,
+		ProcessingTime,
+		ProcessingDist,
+		ProcessingSpread,
+		ProcessingShape,
+		InboxCapacity,
+		Overflow,
+		Topology,
+		TopologyDegree,
+		TopologyProb,
+		TopologyFile,
+		Membership,
+		ViewSize,
+		ShuffleLength,
+		PassiveViewSize,
+		TreeDepth,
+		TreeBranching,
+		Coords,
+		CoordDims,
+		CoordSize,
+		CoordSpread,
+		CoordFile,
+		Jitter,
+		Locality
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		flags.Exper.ID,
 		flags.Exper.Timer,
 		flags.Exper.NodeCount,
@@ -231,6 +440,71 @@ func WriteExperimentToDB() {
 		flags.Exper.AliveProbability,
 		flags.Exper.LossProbability,
 		flags.Exper.CorruptionProbability,
+		flags.Exper.Seed,
+		flags.Exper.VirtualTime,
+		flags.Exper.DelayDistribution,
+		flags.Exper.DelayStdDev,
+		flags.Exper.DelayShape,
+		flags.Exper.LinkModel,
+		flags.Exper.InterDelayMean,
+		flags.Exper.InterLoss,
+		flags.Exper.InterCorruption,
+		flags.Exper.LinkFile,
+		flags.Exper.LossModel,
+		flags.Exper.GEGoodToBad,
+		flags.Exper.GEBadToGood,
+		flags.Exper.GELossGood,
+		flags.Exper.GELossBad,
+		flags.Exper.Partitions,
+		flags.Exper.MessageSize,
+		flags.Exper.UplinkMbps,
+		flags.Exper.DownlinkMbps,
+		flags.Exper.DuplicateProbability,
+		flags.Exper.ReorderProbability,
+		flags.Exper.ReorderWindow,
+		flags.Exper.Checksum,
+		flags.Exper.ChurnMTTF,
+		flags.Exper.ChurnMTTR,
+		flags.Exper.ChurnDistribution,
+		flags.Exper.ChurnSchedule,
+		flags.Exper.ByzantineFraction,
+		flags.Exper.ByzantineIDs,
+		flags.Exper.ByzantineBehavior,
+		flags.Exper.ByzantineTolerance,
+		flags.Exper.Keys,
+		flags.Exper.Updates,
+		flags.Exper.UpdateInterval,
+		flags.Exper.VectorClocks,
+		flags.Exper.CrashState,
+		flags.Exper.SnapshotInterval,
+		flags.Exper.Reliable,
+		flags.Exper.Retries,
+		flags.Exper.AckTimeout,
+		flags.Exper.Backoff,
+		flags.Exper.Transport,
+		flags.Exper.ProcessingTime,
+		flags.Exper.ProcessingDist,
+		flags.Exper.ProcessingSpread,
+		flags.Exper.ProcessingShape,
+		flags.Exper.InboxCapacity,
+		flags.Exper.Overflow,
+		flags.Exper.Topology,
+		flags.Exper.TopologyDegree,
+		flags.Exper.TopologyProb,
+		flags.Exper.TopologyFile,
+		flags.Exper.Membership,
+		flags.Exper.ViewSize,
+		flags.Exper.ShuffleLength,
+		flags.Exper.PassiveViewSize,
+		flags.Exper.TreeDepth,
+		flags.Exper.TreeBranching,
+		flags.Exper.Coords,
+		flags.Exper.CoordDims,
+		flags.Exper.CoordSize,
+		flags.Exper.CoordSpread,
+		flags.Exper.CoordFile,
+		flags.Exper.Jitter,
+		flags.Exper.Locality,
 	)
 	if err != nil {
 		log.Printf("Failed to write experiment to database: %v", err)
@@ -238,3 +512,50 @@ func WriteExperimentToDB() {
 		flags.VPrintln("Experiment written to database successfully")
 	}
 }
+
+// Column describes a table column added after the table was first released.
+type Column struct {
+	Name string
+	Type string
+}
+
+// AddMissingColumns upgrades a table created by an older version of the
+// simulator so that new columns can be written into an existing database.
+func AddMissingColumns(db *sql.DB, tableName string, columns []Column) {
+	rows, err := db.Query("PRAGMA table_info(" + tableName + ")")
+	if err != nil {
+		log.Printf("Failed to read columns of %s: %v", tableName, err)
+		return
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			log.Printf("Failed to scan column of %s: %v", tableName, err)
+			rows.Close()
+			return
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, col := range columns {
+		if existing[col.Name] {
+			continue
+		}
+		_, err := db.Exec("ALTER TABLE " + tableName + " ADD COLUMN " + col.Name + " " + col.Type)
+		if err != nil {
+			log.Printf("Failed to add column %s to %s: %v", col.Name, tableName, err)
+			continue
+		}
+		flags.VPrintln("Column", col.Name, "added to table", tableName)
+	}
+}
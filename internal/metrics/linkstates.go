@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
+)
+
+// WriteLinkStatesToDB stores the Gilbert-Elliott state changes of one simulation,
+// so that coverage drops can be correlated with bad-state periods of the links.
+func WriteLinkStatesToDB(algo string, trace []network.LinkStateChange) {
+	if len(trace) == 0 {
+		return
+	}
+
+	tableName := "LinkStates"
+	db, err := sql.Open("sqlite3", PathDB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	sqlStmt := `
+	CREATE TABLE IF NOT EXISTS ` + tableName + ` (
+	ID            INTEGER PRIMARY KEY AUTOINCREMENT,
+	ExperimentID  INTEGER,
+	Algorithm     TEXT,
+	Time          DATETIME,
+	SenderID      INTEGER,
+	ReceiverID    INTEGER,
+	State         TEXT
+	);`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Failed to start transaction for %s: %v", tableName, err)
+		return
+	}
+	for _, change := range trace {
+		_, err := tx.Exec(`INSERT INTO `+tableName+` (ExperimentID, Algorithm, Time, SenderID, ReceiverID, State) VALUES (?, ?, ?, ?, ?, ?)`,
+			flags.Exper.ID,
+			algo,
+			change.Time.Format("2006-01-02 15:04:05.000000000"),
+			change.SenderID,
+			change.ReceiverID,
+			change.State,
+		)
+		if err != nil {
+			log.Printf("Insert into %s failed: %v", tableName, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to commit %s: %v", tableName, err)
+		return
+	}
+	flags.VPrintln(len(trace), "link state changes written to", tableName)
+}
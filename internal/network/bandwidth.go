@@ -0,0 +1,84 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+)
+
+// Bandwidth limits how fast nodes put messages on and take them off the wire.
+// Every node has one FIFO transmission queue for its uplink and one for its
+// downlink; a message waits until the queue is free and then occupies it for
+// size/bandwidth. Zero bandwidth means the link is never the bottleneck.
+type Bandwidth struct {
+	Uplink   float64 // бит/с
+	Downlink float64 // бит/с
+
+	mu       sync.Mutex
+	upFree   map[int]time.Time // когда освободится очередь отправки узла
+	downFree map[int]time.Time // когда освободится очередь приёма узла
+}
+
+// NewBandwidth converts the per-node limits from Mbit/s.
+func NewBandwidth(uplinkMbps, downlinkMbps float64) *Bandwidth {
+	return &Bandwidth{
+		Uplink:   uplinkMbps * 1e6,
+		Downlink: downlinkMbps * 1e6,
+		upFree:   make(map[int]time.Time),
+		downFree: make(map[int]time.Time),
+	}
+}
+
+// Limited reports whether any queue can delay a message.
+func (b *Bandwidth) Limited() bool {
+	return b != nil && (b.Uplink > 0 || b.Downlink > 0)
+}
+
+// sizeOf returns the number of bytes a message occupies on the wire, so that
+// small control messages pass faster than data messages.
+func (b *Bandwidth) sizeOf(msg node.Message) int {
+	return msg.WireSize()
+}
+
+func serialization(bytes int, bitsPerSecond float64) time.Duration {
+	if bitsPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(bytes) * 8 / bitsPerSecond * float64(time.Second))
+}
+
+// reserve books a FIFO queue starting no earlier than now and returns how long
+// the message waits in the queue and when its transmission is complete.
+func reserve(free map[int]time.Time, id int, now time.Time, tx time.Duration) (time.Duration, time.Time) {
+	start := now
+	if f, ok := free[id]; ok && f.After(now) {
+		start = f
+	}
+	done := start.Add(tx)
+	free[id] = done
+	return start.Sub(now), done
+}
+
+// uplink queues the message at the sender and returns its queueing delay and
+// the moment the last bit leaves the sender.
+func (b *Bandwidth) uplink(senderID int, msg node.Message, now time.Time) (time.Duration, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return reserve(b.upFree, senderID, now, serialization(b.sizeOf(msg), b.Uplink))
+}
+
+// downlink queues the arrived message at the receiver.
+func (b *Bandwidth) downlink(receiverID int, msg node.Message, now time.Time) (time.Duration, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return reserve(b.downFree, receiverID, now, serialization(b.sizeOf(msg), b.Downlink))
+}
+
+// reset empties all queues before the next simulation.
+func (b *Bandwidth) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.upFree = make(map[int]time.Time)
+	b.downFree = make(map[int]time.Time)
+}
@@ -0,0 +1,59 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+)
+
+// SetByzantine picks the Byzantine nodes of the experiment, by explicit IDs
+// or by fraction, and returns the behavior of every node ("" for honest ones).
+// The root node 0 is the trusted source and is never Byzantine.
+func SetByzantine(exper flags.Experiment) ([]string, error) {
+	roles := make([]string, exper.NodeCount)
+	if exper.ByzantineTolerance < 0 || (exper.ByzantineTolerance > 0 && exper.ByzantineTolerance >= exper.NodeCount-1) {
+		return nil, fmt.Errorf("byzantine tolerance must be in [0, %d)", exper.NodeCount-1)
+	}
+	if exper.ByzantineIDs == "" && exper.ByzantineFraction <= 0 {
+		return roles, nil
+	}
+
+	behavior := exper.ByzantineBehavior
+	switch behavior {
+	case node.ByzantineForge, node.ByzantineEquivocate, node.ByzantineDrop, node.ByzantineReplay, node.ByzantineMixed:
+	default:
+		return nil, fmt.Errorf("unknown byzantine behavior %q", behavior)
+	}
+
+	r := rng.New(exper.Seed, "byzantine")
+	var ids []int
+	if exper.ByzantineIDs != "" {
+		var err error
+		ids, err = ParseNodeList(exper.ByzantineIDs, exper.NodeCount)
+		if err != nil {
+			return nil, fmt.Errorf("byzantine nodes: %w", err)
+		}
+		for _, id := range ids {
+			if id == 0 {
+				return nil, fmt.Errorf("byzantine nodes: the root node 0 is trusted")
+			}
+		}
+	} else {
+		count := int(exper.ByzantineFraction*float64(exper.NodeCount) + 0.5)
+		count = min(count, exper.NodeCount-1)
+		for _, i := range r.Perm(exper.NodeCount - 1)[:count] {
+			ids = append(ids, i+1) // узел 0 не выбирается
+		}
+	}
+
+	mixed := []string{node.ByzantineForge, node.ByzantineEquivocate, node.ByzantineDrop, node.ByzantineReplay}
+	for _, id := range ids {
+		roles[id] = behavior
+		if behavior == node.ByzantineMixed {
+			roles[id] = mixed[r.Intn(len(mixed))]
+		}
+	}
+	return roles, nil
+}
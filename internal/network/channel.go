@@ -0,0 +1,108 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// Supported loss models.
+const (
+	LossBernoulli      = "bernoulli"
+	LossGilbertElliott = "gilbert"
+)
+
+// Link channel states of the Gilbert-Elliott model.
+const (
+	StateGood = "good"
+	StateBad  = "bad"
+)
+
+// GilbertElliott is a two-state Markov channel: each message first moves the
+// link between the good and bad states, then is lost with the loss
+// probability of the current state. Bad periods produce bursts of losses.
+type GilbertElliott struct {
+	PGoodToBad float64 // p: вероятность перехода good -> bad
+	PBadToGood float64 // r: вероятность перехода bad -> good
+	LossGood   float64 // k: вероятность потери в хорошем состоянии
+	LossBad    float64 // h: вероятность потери в плохом состоянии
+}
+
+// NewGilbertElliott returns the channel model selected by the experiment,
+// or nil for independent Bernoulli losses.
+func NewGilbertElliott(exper flags.Experiment) (*GilbertElliott, error) {
+	switch exper.LossModel {
+	case LossBernoulli, "":
+		return nil, nil
+	case LossGilbertElliott:
+		ge := &GilbertElliott{
+			PGoodToBad: exper.GEGoodToBad,
+			PBadToGood: exper.GEBadToGood,
+			LossGood:   exper.GELossGood,
+			LossBad:    exper.GELossBad,
+		}
+		for _, p := range []float64{ge.PGoodToBad, ge.PBadToGood, ge.LossGood, ge.LossBad} {
+			if p < 0 || p > 1 {
+				return nil, fmt.Errorf("gilbert-elliott probabilities must be in [0, 1], got %v", p)
+			}
+		}
+		return ge, nil
+	default:
+		return nil, fmt.Errorf("unknown loss model %q", exper.LossModel)
+	}
+}
+
+// LinkStateChange is one transition of a link between the good and bad states.
+type LinkStateChange struct {
+	Time       time.Time
+	SenderID   int
+	ReceiverID int
+	State      string
+}
+
+// linkState is the random stream and channel state of one directed link.
+type linkState struct {
+	r   *rng.Stream
+	bad bool
+
+	sent      uint64 // номер последнего отправленного по каналу сообщения
+	delivered uint64 // наибольший номер доставленного сообщения
+}
+
+// lost advances the channel state of the link and decides whether the
+// message is lost. Must be called with the simulator's links mutex held.
+func (s *Simulator) lost(l *linkState, link *Link, senderID, receiverID int) bool {
+	if s.Channel == nil {
+		return l.r.Float64() < link.LossProbability
+	}
+
+	ge := s.Channel
+	if l.bad {
+		if l.r.Float64() < ge.PBadToGood {
+			l.bad = false
+			s.trace = append(s.trace, LinkStateChange{sim.Now(), senderID, receiverID, StateGood})
+		}
+	} else {
+		if l.r.Float64() < ge.PGoodToBad {
+			l.bad = true
+			s.trace = append(s.trace, LinkStateChange{sim.Now(), senderID, receiverID, StateBad})
+		}
+	}
+
+	if l.bad {
+		return l.r.Float64() < ge.LossBad
+	}
+	return l.r.Float64() < ge.LossGood
+}
+
+// TakeLinkTrace returns the link state changes recorded since the last call.
+func (s *Simulator) TakeLinkTrace() []LinkStateChange {
+	s.linksMu.Lock()
+	defer s.linksMu.Unlock()
+	trace := s.trace
+	s.trace = nil
+	return trace
+}
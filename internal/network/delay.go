@@ -0,0 +1,141 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+)
+
+// DelayModel draws the one-way latency of a single message from the given random stream.
+type DelayModel interface {
+	Sample(r rng.Source) time.Duration
+	String() string
+}
+
+// Supported delay distributions.
+const (
+	DelayUniform     = "uniform"
+	DelayConstant    = "constant"
+	DelayExponential = "exponential"
+	DelayNormal      = "normal"
+	DelayLogNormal   = "lognormal"
+	DelayPareto      = "pareto"
+)
+
+// NewDelayModel builds a delay distribution by name.
+// mean and stddev are in milliseconds, shape is the Pareto tail index.
+// A zero stddev defaults to half of the mean.
+func NewDelayModel(dist string, mean, stddev, shape float64) (DelayModel, error) {
+	if mean < 0 {
+		return nil, fmt.Errorf("delay mean must be non-negative, got %v", mean)
+	}
+	if stddev <= 0 {
+		stddev = mean / 2
+	}
+
+	switch dist {
+	case DelayUniform, "":
+		return uniformDelay{mean: mean}, nil
+	case DelayConstant:
+		return constantDelay{mean: mean}, nil
+	case DelayExponential:
+		return exponentialDelay{mean: mean}, nil
+	case DelayNormal:
+		return normalDelay{mean: mean, stddev: stddev}, nil
+	case DelayLogNormal:
+		// Подбираем mu и sigma так, чтобы среднее и отклонение совпадали с заданными
+		sigma2 := 0.0
+		if mean > 0 {
+			sigma2 = math.Log(1 + (stddev*stddev)/(mean*mean))
+		}
+		return logNormalDelay{
+			mean:   mean,
+			stddev: stddev,
+			mu:     math.Log(math.Max(mean, math.SmallestNonzeroFloat64)) - sigma2/2,
+			sigma:  math.Sqrt(sigma2),
+		}, nil
+	case DelayPareto:
+		if shape <= 1 {
+			return nil, fmt.Errorf("pareto shape must be greater than 1 to have a finite mean, got %v", shape)
+		}
+		return paretoDelay{
+			mean:  mean,
+			shape: shape,
+			scale: mean * (shape - 1) / shape,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown delay distribution %q", dist)
+	}
+}
+
+func millis(ms float64) time.Duration {
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// uniformDelay reproduces the original behaviour: an integer number of
+// milliseconds drawn uniformly from [0, 2*mean).
+type uniformDelay struct{ mean float64 }
+
+func (d uniformDelay) Sample(r rng.Source) time.Duration {
+	upper := int(2 * d.mean)
+	if upper <= 0 {
+		return 0
+	}
+	return time.Duration(r.Intn(upper)) * time.Millisecond
+}
+
+func (d uniformDelay) String() string { return fmt.Sprintf("uniform(0, %v)", 2*d.mean) }
+
+type constantDelay struct{ mean float64 }
+
+func (d constantDelay) Sample(r rng.Source) time.Duration { return millis(d.mean) }
+
+func (d constantDelay) String() string { return fmt.Sprintf("constant(%v)", d.mean) }
+
+type exponentialDelay struct{ mean float64 }
+
+func (d exponentialDelay) Sample(r rng.Source) time.Duration { return millis(r.ExpFloat64() * d.mean) }
+
+func (d exponentialDelay) String() string { return fmt.Sprintf("exponential(mean=%v)", d.mean) }
+
+// normalDelay is truncated at zero: negative samples become an instant delivery.
+type normalDelay struct{ mean, stddev float64 }
+
+func (d normalDelay) Sample(r rng.Source) time.Duration {
+	return millis(d.mean + r.NormFloat64()*d.stddev)
+}
+
+func (d normalDelay) String() string {
+	return fmt.Sprintf("normal(mean=%v, stddev=%v)", d.mean, d.stddev)
+}
+
+type logNormalDelay struct{ mean, stddev, mu, sigma float64 }
+
+func (d logNormalDelay) Sample(r rng.Source) time.Duration {
+	if d.mean == 0 {
+		return 0
+	}
+	return millis(math.Exp(d.mu + r.NormFloat64()*d.sigma))
+}
+
+func (d logNormalDelay) String() string {
+	return fmt.Sprintf("lognormal(mean=%v, stddev=%v)", d.mean, d.stddev)
+}
+
+// paretoDelay has a heavy tail controlled by shape; scale is chosen so that
+// the distribution mean equals the configured mean.
+type paretoDelay struct{ mean, shape, scale float64 }
+
+func (d paretoDelay) Sample(r rng.Source) time.Duration {
+	u := 1 - r.Float64() // (0, 1]
+	return millis(d.scale / math.Pow(u, 1/d.shape))
+}
+
+func (d paretoDelay) String() string {
+	return fmt.Sprintf("pareto(mean=%v, shape=%v)", d.mean, d.shape)
+}
@@ -0,0 +1,294 @@
+package network
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/topology"
+)
+
+// Link holds the properties of a directed link between two nodes.
+type Link struct {
+	Delay                 DelayModel
+	LossProbability       float64
+	CorruptionProbability float64
+}
+
+// LinkModel returns the properties of the link from one node to another.
+type LinkModel interface {
+	Link(from, to int) *Link
+}
+
+// Supported link models.
+const (
+	LinksUniform = "uniform"
+	LinksDomains = "domains"
+	LinksFile    = "file"
+	LinksCoords  = "coords" // задержка по расстоянию между координатами узлов
+)
+
+// UniformLinks applies the same properties to every pair of nodes.
+type UniformLinks struct {
+	Default *Link
+}
+
+func (l UniformLinks) Link(from, to int) *Link { return l.Default }
+
+// DomainLinks distinguishes links inside a multicast domain from links between domains.
+type DomainLinks struct {
+	Intra   *Link
+	Inter   *Link
+	Domains int
+}
+
+func (l DomainLinks) Link(from, to int) *Link {
+	if DomainOf(from, l.Domains) == DomainOf(to, l.Domains) {
+		return l.Intra
+	}
+	return l.Inter
+}
+
+// MatrixLinks holds explicit per-link properties, falling back to Base or,
+// without it, to Default for pairs that were not set.
+type MatrixLinks struct {
+	Default *Link
+	Base    LinkModel
+	links   map[[2]int]*Link
+}
+
+func NewMatrixLinks(def *Link) *MatrixLinks {
+	return &MatrixLinks{Default: def, links: make(map[[2]int]*Link)}
+}
+
+// Set overrides the link from -> to.
+func (l *MatrixLinks) Set(from, to int, link *Link) {
+	l.links[[2]int{from, to}] = link
+}
+
+func (l *MatrixLinks) Link(from, to int) *Link {
+	if link, ok := l.links[[2]int{from, to}]; ok {
+		return link
+	}
+	if l.Base != nil {
+		return l.Base.Link(from, to)
+	}
+	return l.Default
+}
+
+// DomainOf returns the multicast domain of a node: nodes 0..domains-1 are the
+// domain senders, the rest are assigned to them round-robin.
+func DomainOf(id, domains int) int {
+	if domains <= 0 {
+		return 0
+	}
+	if id < domains {
+		return id
+	}
+	return (id - domains) % domains
+}
+
+// NewLinkModel builds the link model selected by the experiment parameters.
+func NewLinkModel(exper flags.Experiment) (LinkModel, error) {
+	delay, err := NewDelayModel(exper.DelayDistribution, float64(exper.DelayMean), exper.DelayStdDev, exper.DelayShape)
+	if err != nil {
+		return nil, err
+	}
+	def := &Link{
+		Delay:                 delay,
+		LossProbability:       exper.LossProbability,
+		CorruptionProbability: exper.CorruptionProbability,
+	}
+
+	switch exper.LinkModel {
+	case LinksUniform, "":
+		return UniformLinks{Default: def}, nil
+
+	case LinksDomains:
+		interDelayMean := exper.InterDelayMean
+		if interDelayMean < 0 {
+			interDelayMean = float64(exper.DelayMean)
+		}
+		interDelay, err := NewDelayModel(exper.DelayDistribution, interDelayMean, exper.DelayStdDev, exper.DelayShape)
+		if err != nil {
+			return nil, err
+		}
+		inter := &Link{
+			Delay:                 interDelay,
+			LossProbability:       orDefault(exper.InterLoss, exper.LossProbability),
+			CorruptionProbability: orDefault(exper.InterCorruption, exper.CorruptionProbability),
+		}
+		return DomainLinks{Intra: def, Inter: inter, Domains: exper.MulticastDomains}, nil
+
+	case LinksFile:
+		return LoadLinkMatrix(exper.LinkFile, exper, def)
+
+	case LinksCoords:
+		// задержки подставляет CoordLinks, когда узлы размещены
+		return UniformLinks{Default: def}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown link model %q", exper.LinkModel)
+	}
+}
+
+// EdgeLinks overrides the links of base with the latency and loss of the
+// edges of a topology file. Properties an edge does not set come from base.
+func EdgeLinks(base LinkModel, exper flags.Experiment, edges []topology.Edge) (LinkModel, error) {
+	if len(edges) == 0 {
+		return base, nil
+	}
+	links := NewMatrixLinks(nil)
+	links.Base = base
+	for _, e := range edges {
+		link := *base.Link(e.From, e.To)
+		if e.Latency >= 0 {
+			delay, err := NewDelayModel(exper.DelayDistribution, e.Latency, exper.DelayStdDev, exper.DelayShape)
+			if err != nil {
+				return nil, fmt.Errorf("edge %d-%d: %w", e.From, e.To, err)
+			}
+			link.Delay = delay
+		}
+		if e.Loss >= 0 {
+			link.LossProbability = e.Loss
+		}
+		links.Set(e.From, e.To, &link)
+	}
+	return links, nil
+}
+
+// CoordLinks derives the delay of every link from the positions of its ends:
+// the distance in ms plus a jitter. Loss and corruption come from Base.
+type CoordLinks struct {
+	Base     LinkModel
+	Jitter   DelayModel
+	Distance func(from, to int) float64
+}
+
+// NewCoordLinks builds the coords link model on top of base; the jitter is
+// drawn from -delay-dist with mean -jitter.
+func NewCoordLinks(base LinkModel, exper flags.Experiment, distance func(from, to int) float64) (*CoordLinks, error) {
+	jitter, err := NewDelayModel(exper.DelayDistribution, exper.Jitter, exper.DelayStdDev, exper.DelayShape)
+	if err != nil {
+		return nil, fmt.Errorf("jitter: %w", err)
+	}
+	return &CoordLinks{Base: base, Jitter: jitter, Distance: distance}, nil
+}
+
+func (l *CoordLinks) Link(from, to int) *Link {
+	link := *l.Base.Link(from, to)
+	link.Delay = distanceDelay{distance: millis(l.Distance(from, to)), jitter: l.Jitter}
+	return &link
+}
+
+// distanceDelay is a fixed propagation delay plus a random jitter.
+type distanceDelay struct {
+	distance time.Duration
+	jitter   DelayModel
+}
+
+func (d distanceDelay) Sample(r rng.Source) time.Duration {
+	return d.distance + d.jitter.Sample(r)
+}
+
+func (d distanceDelay) String() string {
+	return fmt.Sprintf("%v + %v", d.distance, d.jitter)
+}
+
+func orDefault(v, def float64) float64 {
+	if v < 0 {
+		return def
+	}
+	return v
+}
+
+// LoadLinkMatrix reads per-link properties from a CSV file with rows
+//
+//	from,to,delay,loss,corrupt
+//
+// where delay is the mean delay in ms for the configured distribution.
+// Empty fields keep the default value, a header row is allowed, and each row
+// applies to both directions unless the reverse direction is listed later.
+func LoadLinkMatrix(path string, exper flags.Experiment, def *Link) (*MatrixLinks, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open link file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	links := NewMatrixLinks(def)
+	line := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read link file: %w", err)
+		}
+		line++
+
+		if len(row) < 2 {
+			return nil, fmt.Errorf("link file line %d: expected at least from,to", line)
+		}
+		from, errFrom := strconv.Atoi(strings.TrimSpace(row[0]))
+		to, errTo := strconv.Atoi(strings.TrimSpace(row[1]))
+		if errFrom != nil || errTo != nil {
+			if line == 1 {
+				continue // заголовок
+			}
+			return nil, fmt.Errorf("link file line %d: invalid node IDs %q,%q", line, row[0], row[1])
+		}
+		if from < 0 || from >= exper.NodeCount || to < 0 || to >= exper.NodeCount {
+			return nil, fmt.Errorf("link file line %d: node out of range [0, %d)", line, exper.NodeCount)
+		}
+
+		link := *def
+		if v, ok, err := optionalFloat(row, 2); err != nil {
+			return nil, fmt.Errorf("link file line %d: delay: %w", line, err)
+		} else if ok {
+			link.Delay, err = NewDelayModel(exper.DelayDistribution, v, exper.DelayStdDev, exper.DelayShape)
+			if err != nil {
+				return nil, fmt.Errorf("link file line %d: %w", line, err)
+			}
+		}
+		if v, ok, err := optionalFloat(row, 3); err != nil {
+			return nil, fmt.Errorf("link file line %d: loss: %w", line, err)
+		} else if ok {
+			link.LossProbability = v
+		}
+		if v, ok, err := optionalFloat(row, 4); err != nil {
+			return nil, fmt.Errorf("link file line %d: corrupt: %w", line, err)
+		} else if ok {
+			link.CorruptionProbability = v
+		}
+
+		links.Set(from, to, &link)
+		if _, ok := links.links[[2]int{to, from}]; !ok {
+			links.Set(to, from, &link)
+		}
+	}
+	return links, nil
+}
+
+func optionalFloat(row []string, i int) (float64, bool, error) {
+	if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+		return 0, false, nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return v, true, nil
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+)
+
+func TestLoadLinkMatrix(t *testing.T) {
+	exper := flags.Experiment{NodeCount: 3, DelayDistribution: "constant"}
+	defDelay, err := NewDelayModel("constant", 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := &Link{Delay: defDelay, LossProbability: 0.01, CorruptionProbability: 0.02}
+
+	// want описывает канал как задержку (String модели), потерю и искажение
+	type want struct {
+		delay         string
+		loss, corrupt float64
+	}
+	defWant := want{"constant(10)", 0.01, 0.02}
+	tests := []struct {
+		name    string
+		content string
+		links   map[[2]int]want
+		wantErr string
+	}{
+		{
+			name:    "row applies to both directions",
+			content: "0,1,5,0.1,0.2\n",
+			links: map[[2]int]want{
+				{0, 1}: {"constant(5)", 0.1, 0.2},
+				{1, 0}: {"constant(5)", 0.1, 0.2},
+				{0, 2}: defWant,
+			},
+		},
+		{
+			name:    "reverse direction listed later",
+			content: "0,1,5\n1,0,7\n",
+			links: map[[2]int]want{
+				{0, 1}: {"constant(5)", 0.01, 0.02},
+				{1, 0}: {"constant(7)", 0.01, 0.02},
+			},
+		},
+		{
+			name:    "empty fields keep the default",
+			content: "# каналы\nfrom,to,delay,loss,corrupt\n1, 2, , 0.5,\n",
+			links: map[[2]int]want{
+				{1, 2}: {"constant(10)", 0.5, 0.02},
+				{2, 1}: {"constant(10)", 0.5, 0.02},
+			},
+		},
+		{
+			name:    "header only on the first row",
+			content: "0,1\nfrom,to\n",
+			wantErr: `link file line 2: invalid node IDs "from","to"`,
+		},
+		{
+			name:    "node out of range",
+			content: "0,3\n",
+			wantErr: "link file line 1: node out of range [0, 3)",
+		},
+		{
+			name:    "missing to",
+			content: "0\n",
+			wantErr: "link file line 1: expected at least from,to",
+		},
+		{
+			name:    "bad loss",
+			content: "0,1,,x\n",
+			wantErr: "link file line 1: loss",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "links.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			links, err := LoadLinkMatrix(path, exper, def)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadLinkMatrix() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadLinkMatrix() error = %v", err)
+			}
+			for pair, w := range tt.links {
+				l := links.Link(pair[0], pair[1])
+				got := want{l.Delay.String(), l.LossProbability, l.CorruptionProbability}
+				if got != w {
+					t.Errorf("Link(%d, %d) = %+v, want %+v", pair[0], pair[1], got, w)
+				}
+			}
+		})
+	}
+}
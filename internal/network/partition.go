@@ -0,0 +1,169 @@
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// Partition splits the cluster into isolated groups during [Start, End),
+// measured from the start of the simulation. Messages between groups are dropped.
+type Partition struct {
+	Start time.Duration
+	End   time.Duration
+	group []int // номер группы для каждого узла
+}
+
+// Separates reports whether nodes a and b are in different groups.
+func (p Partition) Separates(a, b int) bool {
+	if a < 0 || b < 0 || a >= len(p.group) || b >= len(p.group) {
+		return false
+	}
+	return p.group[a] != p.group[b]
+}
+
+// Active reports whether the partition is in effect at elapsed time t.
+func (p Partition) Active(t time.Duration) bool {
+	return t >= p.Start && t < p.End
+}
+
+// ParsePartitions parses a schedule of partitions separated by ';'.
+// Each partition has the form GROUPS@START-END, where GROUPS is either
+// "domains" (split along the multicast domains) or groups separated by '|',
+// each group being a comma-separated list of node IDs and ranges. Nodes not
+// listed in any group form one more group. START and END are Go durations or
+// plain milliseconds, e.g.
+//
+//	0-49|50-99@200ms-800ms;domains@1s-1.5s
+func ParsePartitions(spec string, nodeCount, domains int) ([]Partition, error) {
+	var partitions []Partition
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		groupsSpec, window, ok := strings.Cut(item, "@")
+		if !ok {
+			return nil, fmt.Errorf("partition %q: missing @START-END", item)
+		}
+		startSpec, endSpec, ok := strings.Cut(window, "-")
+		if !ok {
+			return nil, fmt.Errorf("partition %q: window must be START-END", item)
+		}
+		start, err := ParseMillis(startSpec)
+		if err != nil {
+			return nil, fmt.Errorf("partition %q: start: %w", item, err)
+		}
+		end, err := ParseMillis(endSpec)
+		if err != nil {
+			return nil, fmt.Errorf("partition %q: end: %w", item, err)
+		}
+		if end <= start {
+			return nil, fmt.Errorf("partition %q: end must be after start", item)
+		}
+
+		p := Partition{Start: start, End: end, group: make([]int, nodeCount)}
+		if strings.TrimSpace(groupsSpec) == "domains" {
+			for id := range nodeCount {
+				p.group[id] = DomainOf(id, domains)
+			}
+		} else {
+			groups := strings.Split(groupsSpec, "|")
+			for id := range p.group {
+				p.group[id] = len(groups) // не указанные узлы образуют отдельную группу
+			}
+			for g, members := range groups {
+				ids, err := ParseNodeList(members, nodeCount)
+				if err != nil {
+					return nil, fmt.Errorf("partition %q: %w", item, err)
+				}
+				for _, id := range ids {
+					p.group[id] = g
+				}
+			}
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
+}
+
+// ParseNodeList parses "0-4,7,9-10" into node IDs below nodeCount.
+func ParseNodeList(spec string, nodeCount int) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid node %q", part)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(hi))
+			if err != nil {
+				return nil, fmt.Errorf("invalid node range %q", part)
+			}
+		}
+		if from < 0 || to >= nodeCount || from > to {
+			return nil, fmt.Errorf("node range %q out of [0, %d)", part, nodeCount)
+		}
+		for id := from; id <= to; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// ParseMillis parses a Go duration such as "1.5s" or plain milliseconds.
+func ParseMillis(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		return millis(ms), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// partitioned reports whether a message between the two nodes is cut off
+// by a partition active at the current simulation time.
+func (s *Simulator) partitioned(senderID, receiverID int, now time.Time) bool {
+	elapsed := now.Sub(s.startedAt())
+	for _, p := range s.Partitions {
+		if p.Active(elapsed) && p.Separates(senderID, receiverID) {
+			return true
+		}
+	}
+	return false
+}
+
+// HealTime returns the moment the last scheduled partition heals.
+func (s *Simulator) HealTime() (time.Time, bool) {
+	if len(s.Partitions) == 0 {
+		return time.Time{}, false
+	}
+	var last time.Duration
+	for _, p := range s.Partitions {
+		if p.End > last {
+			last = p.End
+		}
+	}
+	return s.startedAt().Add(last), true
+}
+
+// Delivers reports whether a control message from one node to another gets
+// through now: no partition separates them and the link does not lose it.
+// The loss is drawn from the caller's stream, so control traffic does not
+// shift the randomness of the data messages.
+func (s *Simulator) Delivers(from, to int, r rng.Source) bool {
+	if s.partitioned(from, to, sim.Now()) {
+		return false
+	}
+	return r.Float64() >= s.Links.Link(from, to).LossProbability
+}
@@ -0,0 +1,109 @@
+package network
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePartitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		nodes   int
+		domains int
+		windows [][2]time.Duration
+		groups  [][]int
+		wantErr string
+	}{
+		{
+			name:    "groups with the rest in a group of their own",
+			spec:    "0-1|2,4@200ms-800ms",
+			nodes:   6,
+			windows: [][2]time.Duration{{200 * time.Millisecond, 800 * time.Millisecond}},
+			groups:  [][]int{{0, 0, 1, 2, 1, 2}},
+		},
+		{
+			name:    "domains and plain milliseconds",
+			spec:    " domains@1s-1500 ; ",
+			nodes:   5,
+			domains: 2,
+			windows: [][2]time.Duration{{time.Second, 1500 * time.Millisecond}},
+			groups:  [][]int{{0, 1, 0, 1, 0}},
+		},
+		{
+			name:  "several partitions",
+			spec:  "0@0-10;1@20-30",
+			nodes: 2,
+			windows: [][2]time.Duration{
+				{0, 10 * time.Millisecond},
+				{20 * time.Millisecond, 30 * time.Millisecond},
+			},
+			groups: [][]int{{0, 1}, {1, 0}},
+		},
+		{name: "missing window", spec: "0-1", nodes: 2, wantErr: "missing @START-END"},
+		{name: "missing end", spec: "0@100", nodes: 2, wantErr: "window must be START-END"},
+		{name: "end before start", spec: "0@200ms-100ms", nodes: 2, wantErr: "end must be after start"},
+		{name: "bad start", spec: "0@x-100", nodes: 2, wantErr: "start"},
+		{name: "node out of range", spec: "0-2@0-100", nodes: 2, wantErr: `node range "0-2" out of [0, 2)`},
+		{name: "bad node", spec: "a@0-100", nodes: 2, wantErr: `invalid node "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partitions, err := ParsePartitions(tt.spec, tt.nodes, tt.domains)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePartitions() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePartitions() error = %v", err)
+			}
+			var windows [][2]time.Duration
+			var groups [][]int
+			for _, p := range partitions {
+				windows = append(windows, [2]time.Duration{p.Start, p.End})
+				groups = append(groups, p.group)
+			}
+			if !reflect.DeepEqual(windows, tt.windows) {
+				t.Errorf("windows = %v, want %v", windows, tt.windows)
+			}
+			if !reflect.DeepEqual(groups, tt.groups) {
+				t.Errorf("groups = %v, want %v", groups, tt.groups)
+			}
+		})
+	}
+}
+
+func TestPartition(t *testing.T) {
+	p := Partition{Start: 100 * time.Millisecond, End: 200 * time.Millisecond, group: []int{0, 0, 1}}
+	tests := []struct {
+		a, b int
+		want bool
+	}{
+		{0, 1, false},
+		{0, 2, true},
+		{2, 1, true},
+		{0, 5, false}, // узлы вне разбиения не разделены
+	}
+	for _, tt := range tests {
+		if got := p.Separates(tt.a, tt.b); got != tt.want {
+			t.Errorf("Separates(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+	for _, at := range []struct {
+		t    time.Duration
+		want bool
+	}{
+		{99 * time.Millisecond, false},
+		{100 * time.Millisecond, true},
+		{199 * time.Millisecond, true},
+		{200 * time.Millisecond, false},
+	} {
+		if got := p.Active(at.t); got != at.want {
+			t.Errorf("Active(%v) = %v, want %v", at.t, got, at.want)
+		}
+	}
+}
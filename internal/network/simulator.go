@@ -2,48 +2,264 @@ package network
 
 import (
 	"fmt"
-	"math/rand"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
 	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
 )
 
 type Simulator struct {
-	LossProbability       float64
-	DelayMean             int
-	CorruptionProbability float64
+	Links         LinkModel       // задержка, потери и порча каждого канала
+	Channel       *GilbertElliott // nil для независимых потерь
+	Partitions    []Partition
+	Bandwidth     *Bandwidth
+	DuplicateProb float64
+	ReorderProb   float64
+	ReorderWindow time.Duration
+	Seed          int64
+
+	linksMu sync.Mutex
+	links   map[[2]int]*linkState // отдельный поток случайных чисел и состояние каждого направленного канала
+	trace   []LinkStateChange
+	started time.Time // начало текущей симуляции, от него отсчитываются разделения сети
+
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// Stats counts network events of the current simulation.
+type Stats struct {
+	PartitionDrops   int
+	QueuedMessages   int           // сообщения, прошедшие через очереди передачи
+	QueueingDelay    time.Duration // суммарное время ожидания в очередях
+	MaxQueueingDelay time.Duration
+	Duplicates       int
+	Reorders         int
 }
 
-func NewSimulator(exper flags.Experiment) *Simulator {
-	return &Simulator{exper.LossProbability, exper.DelayMean, exper.CorruptionProbability}
+func NewSimulator(exper flags.Experiment) (*Simulator, error) {
+	links, err := NewLinkModel(exper)
+	if err != nil {
+		return nil, err
+	}
+	channel, err := NewGilbertElliott(exper)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := ParsePartitions(exper.Partitions, exper.NodeCount, exper.MulticastDomains)
+	if err != nil {
+		return nil, err
+	}
+	return &Simulator{
+		Links:         links,
+		Channel:       channel,
+		Partitions:    partitions,
+		Bandwidth:     NewBandwidth(exper.UplinkMbps, exper.DownlinkMbps),
+		DuplicateProb: exper.DuplicateProbability,
+		ReorderProb:   exper.ReorderProbability,
+		ReorderWindow: millis(exper.ReorderWindow),
+		Seed:          exper.Seed,
+		links:         make(map[[2]int]*linkState),
+	}, nil
+}
+
+// linkState returns the state of the directed link sender -> receiver.
+// Keeping faults per link makes the outcome of a message independent of how
+// goroutines sending on other links are scheduled.
+// Must be called with linksMu held.
+func (s *Simulator) linkState(senderID, receiverID int) *linkState {
+	key := [2]int{senderID, receiverID}
+	l, ok := s.links[key]
+	if !ok {
+		l = &linkState{r: rng.New(s.Seed, "network", senderID, receiverID)}
+		s.links[key] = l
+	}
+	return l
 }
 
 func (s *Simulator) Send(sender *node.Node, receiver *node.Node, msg node.Message, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	delay := time.Duration(rand.Intn(2*s.DelayMean)) * time.Millisecond
-	time.Sleep(delay)
+	link := s.Links.Link(sender.ID, receiver.ID)
+	s.linksMu.Lock()
+	l := s.linkState(sender.ID, receiver.ID)
+	delay := link.Delay.Sample(l.r)
+	corrupted := l.r.Float64() < link.CorruptionProbability
+	var flips []int
+	if corrupted {
+		flips = corruptionBits(l.r, msg)
+	}
+	lost := s.lost(l, link, sender.ID, receiver.ID)
+	if s.ReorderProb > 0 && l.r.Float64() < s.ReorderProb {
+		// задержка сверх обычной: сообщение обгонят отправленные позже
+		delay += time.Duration(l.r.Float64() * float64(s.ReorderWindow))
+	}
+	duplicated := s.DuplicateProb > 0 && l.r.Float64() < s.DuplicateProb
+	var dupDelay time.Duration
+	if duplicated {
+		dupDelay = link.Delay.Sample(l.r)
+	}
+	l.sent++
+	seq := l.sent
+	s.linksMu.Unlock()
 
-	if rand.Float64() < s.CorruptionProbability {
-		msg.Data = "corrupted" // corrupted message
+	if duplicated {
+		// копия сообщения идёт по сети независимо, со своей задержкой
+		dup := msg
+		dup.Duplicate = true
+		wg.Add(1)
+		sim.Go(func() {
+			defer wg.Done()
+			s.transmit(sender, receiver, dup, seq, dupDelay, flips, lost)
+		})
 	}
+	s.transmit(sender, receiver, msg, seq, delay, flips, lost)
+}
+
+// corruptionBits picks one to three distinct random bit positions in the payload and checksum.
+func corruptionBits(r rng.Source, msg node.Message) []int {
+	total := len(msg.Payload)*8 + 32
+	count := 1 + r.Intn(3)
+	flips := make([]int, 0, count)
+	seen := make(map[int]bool, count)
+	for len(flips) < count {
+		bit := r.Intn(total)
+		if !seen[bit] {
+			seen[bit] = true
+			flips = append(flips, bit)
+		}
+	}
+	return flips
+}
 
-	if rand.Float64() < s.LossProbability {
-		msg.Data = "lost" // lost message
+// corrupt flips the given bits in a copy of the payload, or in the checksum
+// for positions past the end of the payload.
+func corrupt(msg node.Message, flips []int) node.Message {
+	payload := make([]byte, len(msg.Payload))
+	copy(payload, msg.Payload)
+	for _, bit := range flips {
+		if bit < len(payload)*8 {
+			payload[bit/8] ^= 1 << (bit % 8)
+		} else {
+			msg.Checksum ^= 1 << (bit - len(payload)*8)
+		}
 	}
+	msg.Payload = payload
+	msg.Corrupted = true
+	return msg
+}
+
+// transmit carries one copy of a message through the queues and the link and
+// delivers it with the faults decided by Send.
+func (s *Simulator) transmit(sender *node.Node, receiver *node.Node, msg node.Message, seq uint64, delay time.Duration, flips []int, lost bool) {
+	deliver := func() {
+		s.linksMu.Lock()
+		l := s.linkState(sender.ID, receiver.ID)
+		if seq < l.delivered {
+			msg.Reordered = true // отправленное позже сообщение уже доставлено
+		} else {
+			l.delivered = seq
+		}
+		s.linksMu.Unlock()
+
+		s.statsMu.Lock()
+		if msg.Duplicate {
+			s.stats.Duplicates++
+		}
+		if msg.Reordered {
+			s.stats.Reorders++
+		}
+		s.statsMu.Unlock()
+
+		if len(flips) > 0 {
+			msg = corrupt(msg, flips) // corrupted message
+		}
+
+		if lost {
+			msg.Status = node.Lost // lost message
+		}
+
+		if s.partitioned(sender.ID, receiver.ID, sim.Now()) {
+			msg.Status = node.Lost // узлы в разных частях разделённой сети
+			s.statsMu.Lock()
+			s.stats.PartitionDrops++
+			s.statsMu.Unlock()
+		}
+
+		receiver.Deliver(msg)
+		fmt.Println(strings.Repeat("-", 50))
+		fmt.Println("Sending message from node", sender.ID, "to node", receiver.ID)
+	}
+
+	if !s.Bandwidth.Limited() {
+		sim.Delay(delay, deliver)
+		return
+	}
+
+	// сообщение ждёт в очереди отправителя, передаётся, распространяется по каналу
+	// и затем ждёт в очереди приёма получателя
+	now := sim.Now()
+	upWait, sent := s.Bandwidth.uplink(sender.ID, msg, now)
+	sim.Delay(sent.Sub(now)+delay, func() {
+		arrived := sim.Now()
+		downWait, received := s.Bandwidth.downlink(receiver.ID, msg, arrived)
+		s.recordQueueing(upWait + downWait)
+		sim.Delay(received.Sub(arrived), deliver)
+	})
+}
+
+func (s *Simulator) recordQueueing(wait time.Duration) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.stats.QueuedMessages++
+	s.stats.QueueingDelay += wait
+	if wait > s.stats.MaxQueueingDelay {
+		s.stats.MaxQueueingDelay = wait
+	}
+}
+
+// Reset puts every link back into the good state and restarts the partition
+// schedule and counters before the next simulation.
+func (s *Simulator) Reset() {
+	s.linksMu.Lock()
+	for _, l := range s.links {
+		l.bad = false
+		l.sent = 0
+		l.delivered = 0
+	}
+	s.trace = nil
+	s.started = sim.Now()
+	s.linksMu.Unlock()
+
+	s.Bandwidth.reset()
+
+	s.statsMu.Lock()
+	s.stats = Stats{}
+	s.statsMu.Unlock()
+}
+
+// Stats returns the counters of the current simulation.
+func (s *Simulator) Stats() Stats {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.stats
+}
 
-	receiver.Incoming <- msg
-	fmt.Println(strings.Repeat("-", 50))
-	fmt.Println("Sending message from node", sender.ID, "to node", receiver.ID)
+func (s *Simulator) startedAt() time.Time {
+	s.linksMu.Lock()
+	defer s.linksMu.Unlock()
+	return s.started
 }
 
 func SetAlives(exper flags.Experiment) []*bool {
+	r := rng.New(exper.Seed, "alive")
 	aliveMask := make([]bool, exper.NodeCount, exper.NodeCount)
 	for i := range exper.NodeCount {
-		if rand.Float64() < exper.AliveProbability {
+		if r.Float64() < exper.AliveProbability {
 			aliveMask[i] = true
 		} else {
 			aliveMask[i] = false
@@ -0,0 +1,119 @@
+package node
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+)
+
+// Byzantine behaviors of a node. Honest nodes have an empty Behavior.
+const (
+	ByzantineForge      = "forge"      // подделывает сообщение с завышенным MessageID
+	ByzantineEquivocate = "equivocate" // каждому получателю шлёт свою версию
+	ByzantineDrop       = "drop"       // выборочно не пересылает сообщения
+	ByzantineReplay     = "replay"     // повторяет вытесненное сообщение вместо нового, пока его нет — молчит
+	ByzantineMixed      = "mixed"      // каждому узлу достаётся одно из поведений выше
+)
+
+// forgedIDBoost is added to the MessageID of forged messages so that honest
+// nodes, which keep the highest MessageID, prefer them over the real one.
+const forgedIDBoost = 1_000_000
+
+// dropProbability is the share of outgoing messages a dropping node swallows.
+const dropProbability = 0.5
+
+// CopyByzantine assigns the Byzantine behaviors chosen for the experiment.
+func CopyByzantine(nodes []*Node, roles []string) error {
+	if len(nodes) != len(roles) {
+		return fmt.Errorf("length of nodes and roles must be the same")
+	}
+	for i, n := range nodes {
+		n.Behavior = roles[i]
+		if n.Behavior != "" {
+			n.byzRand = rng.New(flags.Exper.Seed, "byzantine", n.ID)
+		}
+	}
+	return nil
+}
+
+// Byzantine reports whether the node deviates from the protocol.
+func (n *Node) Byzantine() bool {
+	return n.Behavior != ""
+}
+
+// Outgoing applies the node's behavior to a message it is about to send to
+// node to. Honest nodes send msg unchanged; false means the node drops it.
+//
+// A replaying node sends the message its latest one superseded and sends
+// nothing until it has one. With a single rumor, where a node stores one
+// message and never replaces it, replaying nodes therefore only withhold it.
+// Control messages are sent as they are, though a dropping node may drop them.
+func (n *Node) Outgoing(msg Message, to int) (Message, bool) {
+	if msg.Type != "" && msg.Type != TypeData && n.Behavior != ByzantineDrop {
+		return msg, true
+	}
+	switch n.Behavior {
+	case ByzantineForge:
+		return forge(msg, "forged"), true
+
+	case ByzantineEquivocate:
+		return forge(msg, fmt.Sprintf("forged by %d for %d", n.ID, to)), true
+
+	case ByzantineDrop:
+		if n.byzRand.Float64() < dropProbability {
+			n.stateMu.Lock()
+			n.ByzantineDrops++
+			n.stateMu.Unlock()
+			return msg, false
+		}
+
+	case ByzantineReplay:
+		n.stateMu.Lock()
+		replay := n.replay
+		n.stateMu.Unlock()
+		if replay == nil {
+			return msg, false // старого сообщения ещё нет, узел молчит
+		}
+		old := *replay
+		old.SenderID = msg.SenderID
+		old.ResponseChan = msg.ResponseChan
+		old.Replayed = true
+		return old, true
+	}
+	return msg, true
+}
+
+// forge replaces the payload with a fake one carrying a valid checksum, so
+// that only ground truth can tell it from the real message.
+func forge(msg Message, payload string) Message {
+	msg.Data = "OK"
+	msg.MessageID += forgedIDBoost
+	msg.Payload = []byte(payload)
+	msg.Checksum = crc32.ChecksumIEEE(msg.Payload)
+	msg.Corrupted = false
+	msg.Forged = true
+	return msg
+}
+
+// endorsed records that the sender vouches for the content of msg and reports
+// whether the node may accept it. With tolerance f a message must arrive from
+// f+1 distinct senders, so f colluding Byzantine nodes cannot make it stick;
+// the root node 0 is the trusted source and is always accepted.
+func (n *Node) endorsed(msg Message) bool {
+	f := flags.Exper.ByzantineTolerance
+	if f <= 0 || msg.SenderID == 0 {
+		return true
+	}
+	if n.endorsements == nil {
+		n.endorsements = make(map[uint32]map[int]bool)
+	}
+	senders := n.endorsements[msg.Checksum]
+	if senders == nil {
+		senders = make(map[int]bool)
+		n.endorsements[msg.Checksum] = senders
+	}
+	senders[msg.SenderID] = true
+	return len(senders) > f
+}
@@ -0,0 +1,63 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+)
+
+// tick advances the logical clocks of the node for an event it logs.
+// A send stamps msg with the clocks after the event, a receive merges the
+// stamp of msg into them, other events only advance the node's own entry.
+// Duplicate and Reorder rows annotate the receive before them and leave the
+// clocks as they are, and so do messages the node never really got: lost
+// ones and those that reached it while it was down.
+func (n *Node) tick(msg *Message, msgType string) {
+	n.clockMu.Lock()
+	defer n.clockMu.Unlock()
+	if flags.Exper.VectorClocks && n.vector == nil {
+		n.vector = make([]int, flags.Exper.NodeCount)
+	}
+
+	switch msgType {
+	case "Duplicate", "Reorder":
+		return
+	case "Receive":
+		if msg.Status == Lost || !n.IsAlive() {
+			return
+		}
+		n.lamport = max(n.lamport, msg.Lamport)
+		for i, v := range msg.Vector {
+			if i < len(n.vector) {
+				n.vector[i] = max(n.vector[i], v)
+			}
+		}
+	}
+
+	n.lamport++
+	if n.ID < len(n.vector) {
+		n.vector[n.ID]++
+	}
+	if msgType == "Send" {
+		msg.Lamport = n.lamport
+		msg.Vector = append([]int(nil), n.vector...)
+	}
+}
+
+// clocks returns the current Lamport time and vector clock of the node.
+func (n *Node) clocks() (int, []int) {
+	n.clockMu.Lock()
+	defer n.clockMu.Unlock()
+	return n.lamport, append([]int(nil), n.vector...)
+}
+
+// formatVector writes a vector clock as comma-separated entries, empty when
+// vector clocks are off.
+func formatVector(v []int) string {
+	parts := make([]string, len(v))
+	for i, x := range v {
+		parts[i] = strconv.Itoa(x)
+	}
+	return strings.Join(parts, ",")
+}
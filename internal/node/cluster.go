@@ -0,0 +1,128 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// leakTimeout is how long Stop waits for the goroutines of the simulation to exit.
+const leakTimeout = 2 * time.Second
+
+// Cluster is the set of nodes of one simulation together with the lifecycle
+// of their goroutines: Start launches them, Stop cancels them, drains their
+// inboxes, closes their event logs and checks that nothing is left running.
+type Cluster struct {
+	Nodes []*Node
+
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	baseline int // горутины до запуска кластера
+}
+
+func NewCluster(size int) *Cluster {
+	nodes := make([]*Node, size)
+	pending := &sync.WaitGroup{}
+	for i := range nodes {
+		nodes[i] = &Node{
+			ID:       i,
+			Alive:    true,
+			Incoming: make(chan Message, InboxCapacity()),
+			Handler:  DefaultHandler{},
+			Pending:  pending,
+			Timers:   make(chan string, 1),
+		}
+	}
+	// Связываем узлы в Peers
+	for _, n := range nodes {
+		n.Peers = nodes // в простом случае все знают всех
+	}
+	return &Cluster{Nodes: nodes}
+}
+
+// Start opens the event logs and, in real time, starts one goroutine per node.
+// On the virtual clock nodes handle messages in scheduler events instead.
+func (c *Cluster) Start(ctx context.Context) error {
+	c.baseline = runtime.NumGoroutine()
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	for _, n := range c.Nodes {
+		// журнал открывается заранее: отказы узлов пишутся в него и вне Run
+		if err := n.Open(); err != nil {
+			c.cancel()
+			return fmt.Errorf("open event log of node %d: %w", n.ID, err)
+		}
+		n.done = ctx.Done()
+		// снимок прошлой симуляции не должен пережить её
+		if err := n.RemoveSnapshot(); err != nil {
+			c.cancel()
+			return fmt.Errorf("remove snapshot of node %d: %w", n.ID, err)
+		}
+	}
+
+	if sim.Virtual() {
+		return nil
+	}
+	for _, n := range c.Nodes {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			n.Run(ctx)
+		}()
+		flags.VPrintln("Node", n.ID, "started")
+	}
+	return nil
+}
+
+// Stop shuts the cluster down, waits for the node goroutines and removes the
+// snapshots of the nodes. It returns
+// the number of goroutines started during the simulation that are still
+// running after leakTimeout, with an error if there are any.
+func (c *Cluster) Stop() (int, error) {
+	if c.cancel == nil {
+		return 0, nil
+	}
+	c.cancel()
+	c.Wait()
+
+	for _, n := range c.Nodes {
+		if sim.Virtual() {
+			if err := n.Close(); err != nil {
+				fmt.Println("Error closing CSV file:", err)
+			}
+		}
+		if err := n.RemoveSnapshot(); err != nil {
+			fmt.Println("Error removing snapshot:", err)
+		}
+	}
+
+	// сообщения в пути и ответы досылаются ещё немного после остановки
+	deadline := time.Now().Add(leakTimeout)
+	leaked := runtime.NumGoroutine() - c.baseline
+	for leaked > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		leaked = runtime.NumGoroutine() - c.baseline
+	}
+	if leaked > 0 {
+		return leaked, fmt.Errorf("%d goroutines still running after the simulation", leaked)
+	}
+	return 0, nil
+}
+
+// Cancel stops deliveries to the nodes without waiting for them: nodes no
+// longer wait for their replies or timers to be taken. Stop must still be called.
+func (c *Cluster) Cancel() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// Wait blocks until every node goroutine has exited.
+func (c *Cluster) Wait() {
+	c.wg.Wait()
+}
@@ -0,0 +1,63 @@
+package node
+
+// Message types. Data messages carry what the algorithm disseminates; the
+// others are control messages of the protocols.
+const (
+	TypeData        = "data"
+	TypeReply       = "reply"        // ответ получателя на ResponseChan
+	TypeAck         = "ack"          // подтверждение надёжного транспорта
+	TypePullRequest = "pull-request" // запрос недостающих данных со сводкой того, что есть у узла
+)
+
+// HeaderBytes is the size of the fixed part of the envelope on the wire:
+// type, IDs, checksum, clocks and sequence numbers.
+const HeaderBytes = 64
+
+// Status is what happened to a message on its way. It is set by the network
+// and the receiver and is not part of what the sender sends.
+type Status int
+
+const (
+	Delivered Status = iota
+	Lost             // сеть не доставила сообщение
+	Corrupted        // получатель обнаружил порчу по контрольной сумме
+)
+
+func (s Status) String() string {
+	switch s {
+	case Lost:
+		return "lost"
+	case Corrupted:
+		return "corrupted"
+	default:
+		return "delivered"
+	}
+}
+
+// Label describes the message in event logs and replies: its delivery status
+// if it did not arrive intact, otherwise its data or, for control messages
+// without data, its type.
+func (m Message) Label() string {
+	if m.Status != Delivered {
+		return m.Status.String()
+	}
+	if m.Data == "" {
+		return m.Type
+	}
+	return m.Data
+}
+
+// WireSize is the number of bytes the message occupies on the wire: the
+// envelope, the header fields, the store entries and the payload, which is
+// at least its declared Size.
+func (m Message) WireSize() int {
+	size := HeaderBytes + len(m.Type) + len(m.Data)
+	for k, v := range m.Header {
+		size += len(k) + len(v)
+	}
+	for _, e := range m.Entries {
+		size += len(e.Key) + len(e.Value) + 16 // версия и источник
+	}
+	size += 8 * len(m.Vector)
+	return size + max(m.Size, len(m.Payload))
+}
@@ -0,0 +1,213 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+	"github.com/fatih/color"
+)
+
+// Handler is the per-node logic of a dissemination algorithm. The node does
+// the common work (checksum, event log, dropping messages while it is down)
+// and delegates the rest: what to store, what to answer and what to send next.
+// Each node gets its own Handler, so a handler can keep per-node state.
+type Handler interface {
+	// HandleMessage is called for every message that reached the node while it is alive.
+	HandleMessage(n *Node, msg Message)
+	// HandleTimer is called when a timer set with Node.SetTimer fires.
+	HandleTimer(n *Node, name string)
+}
+
+// Transport carries messages between nodes. network.Simulator is the transport
+// of the simulation; Send must call wg.Done once the message has been delivered.
+type Transport interface {
+	Send(sender *Node, receiver *Node, msg Message, wg *sync.WaitGroup)
+}
+
+// Acknowledger is implemented by transports that wait for acknowledgements.
+// Acknowledge is called for every message that reached a node that is up and
+// reports whether the node sees it for the first time; Acked is called for
+// every acknowledgement that reached a node.
+type Acknowledger interface {
+	Acknowledge(n *Node, msg Message) bool
+	Acked(n *Node, ack Message)
+}
+
+// acknowledge confirms msg if the transport wants acknowledgements and
+// reports whether the node should handle it.
+func (n *Node) acknowledge(msg Message) bool {
+	a, ok := n.Net.(Acknowledger)
+	if !ok || msg.Seq == 0 {
+		return true
+	}
+	return a.Acknowledge(n, msg)
+}
+
+// acked passes an acknowledgement to the transport unless it was lost or
+// damaged on the way or the node is down.
+func (n *Node) acked(ack Message) {
+	a, ok := n.Net.(Acknowledger)
+	if !ok || !n.IsAlive() || ack.Type != TypeAck || ack.Status != Delivered {
+		return
+	}
+	if flags.Exper.Checksum && !ack.Valid() {
+		return
+	}
+	a.Acked(n, ack)
+}
+
+// DefaultHandler is the behavior every node had before handlers existed:
+// keep the message with the highest MessageID and reply on ResponseChan.
+type DefaultHandler struct{}
+
+func (h DefaultHandler) HandleMessage(n *Node, msg Message) {
+	h.Accept(n, msg)
+	n.Reply(msg)
+}
+
+func (DefaultHandler) HandleTimer(n *Node, name string) {}
+
+// Accept stores msg in the node's DB if it is intact, vouched for and newer
+// than what the node holds, and reports whether it was stored. The entries of
+// an intact, vouched-for message are merged into the store in any case.
+// A node that crashed while handling msg stores nothing.
+func (DefaultHandler) Accept(n *Node, msg Message) bool {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	if !n.IsAlive() {
+		return false
+	}
+	before := n.mark()
+	defer n.catchUp()
+	defer n.persistChange(before)
+
+	if msg.Status == Corrupted {
+		// повреждённое сообщение не сохраняем, отправитель получит ответ "corrupted"
+		color.Yellow("Node %d detected a corrupted message, rejecting it: %v\n", n.ID, msg)
+		n.CorruptedRejected++
+		return false
+	}
+	if !n.endorsed(msg) {
+		// версию должны подтвердить f+1 разных отправителей
+		color.Yellow("Node %d holds back a message until %d senders vouch for it: %v\n", n.ID, flags.Exper.ByzantineTolerance+1, msg)
+		return false
+	}
+
+	color.Green("Node %d is alive, msg: %v\n", n.ID, msg)
+	n.Store.Merge(msg.Entries) // записи сливаются независимо от MessageID
+	if msg.MessageID <= n.DB.MessageID {
+		color.Yellow("Node %d received a message with an old ID: (%d < %d), ignoring it\n", n.ID, msg.MessageID, n.DB.MessageID)
+		return false
+	}
+
+	color.Green("Node %d received a new message with ID: (%d > %d), processing it\n", n.ID, msg.MessageID, n.DB.MessageID)
+	msg.ResponseChan = nil
+	msg.tracker = nil
+	if n.Behavior == ByzantineReplay && n.DB.Data != "" {
+		old := n.DB // вытесненное сообщение узел будет выдавать за актуальное
+		n.replay = &old
+	}
+	n.DB = msg // сохраняем сообщение в базе данных узла
+	return true
+}
+
+// Reply answers the sender of msg on its ResponseChan, if it asked for an answer.
+// In real time it gives up once the cluster stops, since nobody reads the
+// answers of a finished simulation any more.
+func (n *Node) Reply(msg Message) {
+	if msg.ResponseChan == nil {
+		return
+	}
+	ResMsg := Message{
+		Type:      TypeReply,
+		SenderID:  n.ID,          // Устанавливаем ID отправителя
+		Data:      msg.Data,      // Устанавливаем данные сообщения
+		MessageID: msg.MessageID, // Сохраняем ID сообщения
+		Status:    msg.Status,    // отправитель узнаёт, дошло ли сообщение целым
+	}
+	if sim.Virtual() {
+		sim.TrySend(msg.ResponseChan, ResMsg) // отправляем сообщение обратно в канал
+		return
+	}
+	select {
+	case msg.ResponseChan <- ResMsg:
+	case <-n.done:
+	}
+}
+
+// Send sends msg to another node through the node's transport and logs it.
+// Byzantine nodes may alter or drop it. The message stays in n.Pending until
+// the receiver has handled it, so waiting on Pending also waits for
+// everything the receiver sends in turn.
+func (n *Node) Send(to *Node, msg Message) error {
+	if n.Crashed() {
+		return nil // упавший узел ничего не отправляет
+	}
+	msg.SenderID = n.ID
+	msg, ok := n.Outgoing(msg, to.ID)
+	if !ok {
+		return nil
+	}
+
+	flags.VPrintln(n.ID, "->", to.ID, "msg:", msg)
+	if err := WriteToCSV(n.writer, n, &msg, "Send"); err != nil {
+		return fmt.Errorf("log send: %w", err)
+	}
+
+	wg := n.Pending
+	wg.Add(2) // доставка и обработка получателем
+	msg.tracker = &tracker{wg: wg}
+	sim.Go(func() { n.Net.Send(n, to, msg, wg) })
+	return nil
+}
+
+// SetTimer makes the handler's HandleTimer fire with name after d.
+// Pending timers are waited for like messages in flight.
+func (n *Node) SetTimer(d time.Duration, name string) {
+	wg := n.Pending
+	wg.Add(1)
+	if sim.Virtual() {
+		sim.Delay(d, func() { n.timer(name) })
+		return
+	}
+	time.AfterFunc(d, func() {
+		select {
+		case n.Timers <- name:
+		case <-n.done:
+			wg.Done() // кластер остановлен
+		}
+	})
+}
+
+// timer runs a fired timer unless the node is down.
+func (n *Node) timer(name string) {
+	defer n.Pending.Done()
+	if !n.IsAlive() {
+		return
+	}
+	n.handler().HandleTimer(n, name)
+}
+
+func (n *Node) handler() Handler {
+	if n.Handler == nil {
+		return DefaultHandler{}
+	}
+	return n.Handler
+}
+
+// tracker releases a message sent with Node.Send once it has been handled.
+// Copies made by the network share the tracker, so the first handled copy
+// releases it.
+type tracker struct {
+	once sync.Once
+	wg   *sync.WaitGroup
+}
+
+func (m Message) settle() {
+	if m.tracker != nil {
+		m.tracker.once.Do(m.tracker.wg.Done)
+	}
+}
@@ -0,0 +1,144 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// What a node does with a message that arrives when its inbox is full.
+const (
+	OverflowBlock      = "block"       // отправитель ждёт, пока место освободится
+	OverflowDropNewest = "drop-newest" // пришедшее сообщение отбрасывается
+	OverflowDropOldest = "drop-oldest" // вытесняется самое старое сообщение в очереди
+)
+
+// InboxCapacity is the number of messages waiting in the inbox of a node;
+// without -inbox it is the number of nodes.
+func InboxCapacity() int {
+	if flags.Exper.InboxCapacity > 0 {
+		return flags.Exper.InboxCapacity
+	}
+	return flags.Exper.NodeCount
+}
+
+// InboxStats returns how many messages the node dropped because its inbox was
+// full and the longest its inbox has been.
+func (n *Node) InboxStats() (drops, longest int) {
+	n.inboxMu.Lock()
+	defer n.inboxMu.Unlock()
+	return n.inboxDrops, n.longestInbox
+}
+
+// enqueue puts msg into Incoming according to the overflow policy.
+// Used in real time.
+func (n *Node) enqueue(msg Message) {
+	switch flags.Exper.Overflow {
+	case OverflowDropNewest:
+		select {
+		case n.Incoming <- msg:
+			n.noteInbox(len(n.Incoming))
+		case <-n.done:
+			msg.settle()
+		default:
+			n.overflow(msg)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case n.Incoming <- msg:
+				n.noteInbox(len(n.Incoming))
+				return
+			case <-n.done:
+				msg.settle()
+				return
+			default:
+			}
+			select {
+			case old := <-n.Incoming:
+				n.overflow(old)
+			default: // узел сам успел забрать сообщение
+			}
+		}
+	default:
+		select {
+		case n.Incoming <- msg:
+			n.noteInbox(len(n.Incoming))
+		case <-n.done:
+			msg.settle() // кластер остановлен, сообщение некому обработать
+		}
+	}
+}
+
+// queue handles msg after the processing time of the node on the virtual
+// clock. Messages that arrive while the node is busy wait in its queue; with
+// the block policy the queue has no limit, since virtual senders cannot wait.
+func (n *Node) queue(msg Message) {
+	n.inboxMu.Lock()
+	if !n.busy {
+		n.busy = true
+		n.inboxMu.Unlock()
+		n.process(msg)
+		return
+	}
+	if len(n.waiting) < InboxCapacity() || flags.Exper.Overflow == OverflowBlock {
+		n.waiting = append(n.waiting, msg)
+		n.longestInbox = max(n.longestInbox, len(n.waiting))
+		n.inboxMu.Unlock()
+		return
+	}
+	dropped := msg
+	if flags.Exper.Overflow == OverflowDropOldest {
+		dropped = n.waiting[0]
+		n.waiting = append(n.waiting[1:], msg)
+	}
+	n.inboxMu.Unlock()
+	n.overflow(dropped)
+}
+
+// process handles msg once its processing time has passed, then takes the
+// next waiting message.
+func (n *Node) process(msg Message) {
+	sim.Delay(n.processingTime(), func() {
+		if err := n.handle(msg); err != nil {
+			fmt.Println("Error handling message:", err)
+		}
+		n.inboxMu.Lock()
+		if len(n.waiting) == 0 {
+			n.busy = false
+			n.inboxMu.Unlock()
+			return
+		}
+		next := n.waiting[0]
+		n.waiting = n.waiting[1:]
+		n.inboxMu.Unlock()
+		n.process(next)
+	})
+}
+
+// processingTime draws how long the node takes to handle the next message.
+func (n *Node) processingTime() time.Duration {
+	if n.Processing == nil {
+		return 0
+	}
+	return n.Processing()
+}
+
+func (n *Node) noteInbox(length int) {
+	n.inboxMu.Lock()
+	n.longestInbox = max(n.longestInbox, length)
+	n.inboxMu.Unlock()
+}
+
+// overflow drops a message the inbox had no room for.
+func (n *Node) overflow(msg Message) {
+	n.inboxMu.Lock()
+	n.inboxDrops++
+	n.inboxMu.Unlock()
+	if err := n.LogEvent(&msg, "Overflow"); err != nil {
+		fmt.Println("Error writing to CSV:", err)
+	}
+	msg.settle()
+}
@@ -0,0 +1,186 @@
+package node
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+	"github.com/fatih/color"
+)
+
+// Entry is one versioned key of the node's key-value store.
+type Entry struct {
+	Key     string
+	Value   string
+	Version int
+	Origin  int // узел, записавший эту версию
+}
+
+// Newer reports whether e wins over other under last-writer-wins merging:
+// the higher version wins, and concurrent writes with the same version are
+// ordered by origin so that every node picks the same one.
+func (e Entry) Newer(other Entry) bool {
+	if e.Version != other.Version {
+		return e.Version > other.Version
+	}
+	return e.Origin > other.Origin
+}
+
+// Applied records when an entry was stored by a node. A crash that emptied
+// the store is recorded too, with Wiped set and no entry: what the node
+// stored before it no longer counts.
+type Applied struct {
+	Entry Entry
+	Time  time.Time
+	Wiped bool
+}
+
+// Store is a versioned key-value store. It is safe for concurrent use: the
+// node goroutine merges into it while updates are written by the workload.
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	history []Applied
+}
+
+// Merge stores every entry that is newer than the one the store holds and
+// returns the entries that were applied.
+func (s *Store) Merge(entries []Entry) []Entry {
+	if len(entries) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var applied []Entry
+	for _, e := range entries {
+		if s.put(e) {
+			applied = append(applied, e)
+		}
+	}
+	return applied
+}
+
+// put stores e if it is newer. Must be called with s.mu held.
+func (s *Store) put(e Entry) bool {
+	if s.entries == nil {
+		s.entries = make(map[string]Entry)
+	}
+	if old, ok := s.entries[e.Key]; ok && !e.Newer(old) {
+		return false
+	}
+	s.entries[e.Key] = e
+	s.history = append(s.history, Applied{Entry: e, Time: sim.Now()})
+	return true
+}
+
+// Get returns the entry stored under key.
+func (s *Store) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	return e, ok
+}
+
+// Entries returns a copy of all entries sorted by key.
+func (s *Store) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		return nil
+	}
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Covers reports whether the store holds each of entries or a newer version.
+func (s *Store) Covers(entries []Entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		mine, ok := s.entries[e.Key]
+		if !ok || e.Newer(mine) {
+			return false
+		}
+	}
+	return true
+}
+
+// reset empties the store, as a crash does. The history is kept, with the
+// crash marked in it, for the analysis.
+func (s *Store) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = nil
+	s.history = append(s.history, Applied{Time: sim.Now(), Wiped: true})
+}
+
+// load replaces the entries of the store with restored ones. They are added
+// to the history as applied now: the crash before emptied the store.
+func (s *Store) load(entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		s.entries[e.Key] = e
+		s.history = append(s.history, Applied{Entry: e, Time: sim.Now()})
+	}
+}
+
+// changes counts the changes of the store so far, crashes included.
+func (s *Store) changes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.history)
+}
+
+// History returns the entries in the order the store applied them.
+func (s *Store) History() []Applied {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Applied(nil), s.history...)
+}
+
+// Update writes a new version of key at the node, as a client of this node
+// would, and logs it. The version is one above what the node knows.
+func (n *Node) Update(key, value string) Entry {
+	n.stateMu.Lock()
+	before := n.mark()
+	n.Store.mu.Lock()
+	e := Entry{Key: key, Value: value, Version: 1, Origin: n.ID}
+	if old, ok := n.Store.entries[key]; ok {
+		e.Version = old.Version + 1
+	}
+	n.Store.put(e)
+	n.Store.mu.Unlock()
+	n.persistChange(before)
+	n.stateMu.Unlock()
+
+	msg := Message{SenderID: n.ID, Data: key, MessageID: e.Version}
+	if err := n.LogEvent(&msg, "Update"); err != nil {
+		color.Red("Error logging update of node %d: %v", n.ID, err)
+	}
+	return e
+}
+
+// Converged reports whether every node that is up holds the same entries,
+// i.e. whatever any of them knows has reached all of them.
+func Converged(nodes []*Node) bool {
+	var target Store
+	for _, n := range nodes {
+		if n.IsAlive() {
+			target.Merge(n.Store.Entries())
+		}
+	}
+	want := target.Entries()
+	for _, n := range nodes {
+		if n.IsAlive() && !n.Store.Covers(want) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEntryNewer(t *testing.T) {
+	tests := []struct {
+		name    string
+		e, than Entry
+		want    bool
+	}{
+		{"higher version", Entry{Version: 2, Origin: 0}, Entry{Version: 1, Origin: 5}, true},
+		{"lower version", Entry{Version: 1, Origin: 5}, Entry{Version: 2, Origin: 0}, false},
+		{"same version, higher origin", Entry{Version: 3, Origin: 4}, Entry{Version: 3, Origin: 2}, true},
+		{"same version, lower origin", Entry{Version: 3, Origin: 2}, Entry{Version: 3, Origin: 4}, false},
+		{"same entry", Entry{Version: 3, Origin: 2}, Entry{Version: 3, Origin: 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.e.Newer(tt.than); got != tt.want {
+				t.Errorf("%+v.Newer(%+v) = %v, want %v", tt.e, tt.than, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreMerge(t *testing.T) {
+	var s Store
+	first := []Entry{
+		{Key: "a", Value: "a1", Version: 1, Origin: 0},
+		{Key: "b", Value: "b2", Version: 2, Origin: 1},
+	}
+	if got := s.Merge(first); !reflect.DeepEqual(got, first) {
+		t.Fatalf("Merge() into an empty store = %v, want %v", got, first)
+	}
+
+	second := []Entry{
+		{Key: "a", Value: "a1'", Version: 1, Origin: 3}, // та же версия, узел старше: побеждает
+		{Key: "b", Value: "b1", Version: 1, Origin: 9},  // старая версия
+		{Key: "b", Value: "b2", Version: 2, Origin: 1},  // уже есть
+		{Key: "c", Value: "c1", Version: 1, Origin: 2},
+	}
+	want := []Entry{second[0], second[3]}
+	if got := s.Merge(second); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %v, want %v", got, want)
+	}
+	if got := s.Merge(nil); got != nil {
+		t.Errorf("Merge(nil) = %v, want nil", got)
+	}
+
+	wantEntries := []Entry{second[0], first[1], second[3]}
+	if got := s.Entries(); !reflect.DeepEqual(got, wantEntries) {
+		t.Errorf("Entries() = %v, want %v", got, wantEntries)
+	}
+	if got := len(s.History()); got != 4 {
+		t.Errorf("History() has %d entries, want 4", got)
+	}
+}
+
+func TestStoreCovers(t *testing.T) {
+	var s Store
+	s.Merge([]Entry{
+		{Key: "a", Version: 2, Origin: 1},
+		{Key: "b", Version: 1, Origin: 1},
+	})
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    bool
+	}{
+		{"nothing", nil, true},
+		{"same versions", []Entry{{Key: "a", Version: 2, Origin: 1}, {Key: "b", Version: 1, Origin: 1}}, true},
+		{"older version", []Entry{{Key: "a", Version: 1, Origin: 7}}, true},
+		{"newer version", []Entry{{Key: "a", Version: 3, Origin: 0}}, false},
+		{"same version, higher origin", []Entry{{Key: "b", Version: 1, Origin: 2}}, false},
+		{"unknown key", []Entry{{Key: "c", Version: 1, Origin: 0}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Covers(tt.entries); got != tt.want {
+				t.Errorf("Covers(%v) = %v, want %v", tt.entries, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConverged(t *testing.T) {
+	v1 := Entry{Key: "k", Value: "v1", Version: 1, Origin: 0}
+	v2 := Entry{Key: "k", Value: "v2", Version: 2, Origin: 1}
+	other := Entry{Key: "x", Value: "x1", Version: 1, Origin: 2}
+
+	// узел описывается его записями и тем, жив ли он
+	type state struct {
+		alive   bool
+		entries []Entry
+	}
+	tests := []struct {
+		name  string
+		nodes []state
+		want  bool
+	}{
+		{"all empty", []state{{true, nil}, {true, nil}}, true},
+		{"same entries", []state{{true, []Entry{v2, other}}, {true, []Entry{v2, other}}}, true},
+		{"stale version", []state{{true, []Entry{v2}}, {true, []Entry{v1}}}, false},
+		{"missing key", []state{{true, []Entry{v2, other}}, {true, []Entry{v2}}}, false},
+		{"crashed node is ignored", []state{{true, []Entry{v2}}, {true, []Entry{v2}}, {false, []Entry{v1}}}, true},
+		{"newer entry on a crashed node does not count", []state{{true, []Entry{v1}}, {false, []Entry{v2, other}}}, true},
+		{"no node alive", []state{{false, []Entry{v1}}, {false, []Entry{v2}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := make([]*Node, len(tt.nodes))
+			for i, st := range tt.nodes {
+				nodes[i] = &Node{ID: i, Alive: st.alive}
+				nodes[i].Store.Merge(st.entries)
+			}
+			if got := Converged(nodes); got != tt.want {
+				t.Errorf("Converged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package node
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"os"
@@ -8,6 +9,8 @@ import (
 	"time"
 
 	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
 	"github.com/fatih/color"
 )
 
@@ -29,14 +32,107 @@ type Node struct {
 	// Other nodes send Message objects into this channel.
 
 	DB Message
-	// Database to store messages received by the node.
+	// Database to store messages received by the node. Read it through Stored while the simulation runs.
+
+	Store Store
+	// Versioned key-value store, merged from the entries carried by messages.
+
+	CorruptedRejected int
+	// Number of corrupted messages detected by the checksum and rejected.
+
+	CatchUps []time.Duration
+	// How long the node took after each recovery to hold the message again.
+
+	Handler Handler
+	// Per-node logic of the dissemination algorithm (DefaultHandler if nil).
+
+	Net Transport
+	// Transport used by Send.
+
+	Pending *sync.WaitGroup
+	// Messages sent with Send and timers that have not been handled yet, shared by the cluster.
+
+	Timers chan string
+	// Fired timers waiting for the node goroutine.
+
+	Behavior string
+	// Byzantine behavior of the node (see ByzantineForge and others), empty for honest nodes.
+
+	ByzantineDrops int
+	// Number of messages a dropping Byzantine node swallowed.
+
+	Processing func() time.Duration
+	// Draws how long the node takes to handle a message; nil handles it instantly.
+
+	ProcessingMean time.Duration
+	// Mean processing time of the node, for the results.
+
+	Coord []float64
+	// Position of the node in the latency space (nil without -coords).
+
+	byzRand      *rng.Stream
+	replay       *Message                // сообщение, вытесненное из DB; его повторяет узел с поведением replay
+	endorsements map[uint32]map[int]bool // отправители, подтвердившие каждую версию сообщения
+
+	clockMu sync.Mutex
+	lamport int
+	vector  []int
+	// Logical clocks of the node, advanced by every event it logs.
+
+	stateMu     sync.Mutex
+	recoveredAt time.Time // последнее восстановление, после которого узел ещё не догнал остальных
+	// Guards the DB, the store and the Byzantine state (replay, ByzantineDrops)
+	// against a crash while they change. It is held only while the state
+	// changes, never across handler callbacks, so handlers may call any method
+	// of the node.
+
+	inboxMu      sync.Mutex
+	inboxDrops   int
+	longestInbox int
+	busy         bool      // на виртуальных часах: узел обрабатывает сообщение
+	waiting      []Message // на виртуальных часах: очередь входящих сообщений
+	// Overflow counters of the inbox and, on the virtual clock, the inbox itself.
+
+	aliveMu sync.Mutex
+	crashed bool
+	// Guards Alive once the simulation runs: churn flips it while messages are handled.
+	// A crashed node is down because of churn and, unlike a node that is dead
+	// from the start, also stops sending.
+
+	file   *os.File
+	writer *SafeWriter
+	// CSV event log of the node.
+
+	done <-chan struct{}
+	// Closed when the cluster stops; nothing is delivered to the node afterwards.
 }
 
+// Message is the envelope nodes exchange. Type, the header fields, the
+// payload and Size are what the sender sends; Status is what happened to the
+// message on the way.
 type Message struct {
+	Type         string // TypeData и другие; пусто у сообщений, созданных до конверта
 	SenderID     int
-	Data         string
+	Data         string // значение, которое распространяет алгоритм
 	MessageID    int
 	ResponseChan chan Message
+	Header       map[string]string // дополнительные поля заголовка протокола
+	Payload      []byte
+	Size         int // объявленный размер полезной нагрузки в байтах
+	Checksum     uint32
+	Status       Status  // доставлено, потеряно или испорчено
+	Entries      []Entry // записи хранилища ключ-значение, которые несёт сообщение
+	Lamport      int     // время Лампорта отправителя в момент отправки
+	Vector       []int   // векторные часы отправителя, если они включены
+	Seq          uint64  // номер сообщения на надёжном транспорте
+	AckFor       uint64  // подтверждение: номер подтверждаемого сообщения
+	Duplicate    bool    // копия, созданная сетью
+	Reordered    bool    // доставлено позже сообщения, отправленного после него
+	Corrupted    bool    // сеть повредила полезную нагрузку; узлы это поле не читают, оно нужно только для метрик
+	Forged       bool    // подделано византийским узлом; как и Corrupted, только для метрик
+	Replayed     bool    // повтор старого сообщения византийским узлом
+
+	tracker *tracker // учёт сообщения, отправленного через Node.Send
 }
 
 type SafeWriter struct {
@@ -44,78 +140,218 @@ type SafeWriter struct {
 	Mutex  sync.Mutex
 }
 
-func (n *Node) Run() {
-
+// Open prepares the node's CSV event log. Run opens it automatically;
+// on the virtual clock nodes are not goroutines and the log is opened up front.
+func (n *Node) Open() error {
 	csvFile, err := os.OpenFile("metrics/metrics_node_"+fmt.Sprintf("%d", n.ID)+".csv", os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
-		fmt.Println("Error opening CSV file:", err)
-		return
+		return err
 	}
-	writer := &SafeWriter{Writer: csv.NewWriter(csvFile)}
+	n.file = csvFile
+	n.writer = &SafeWriter{Writer: csv.NewWriter(csvFile)}
+	return nil
+}
 
-	defer csvFile.Close()
+// Run processes messages and timers until ctx is cancelled, then drains
+// Incoming so that every delivered message is logged, and closes the event log.
+func (n *Node) Run(ctx context.Context) {
+	if n.writer == nil {
+		if err := n.Open(); err != nil {
+			fmt.Println("Error opening CSV file:", err)
+			return
+		}
+	}
+	defer n.Close()
 
 	for {
 		select {
+		case <-ctx.Done():
+			n.drain()
+			return
 		case msg := <-n.Incoming:
-			// обработка сообщения
-			// Записываем в CSV
-			err = WriteToCSV(writer, n, &msg, "Receive")
-			if err != nil {
-				fmt.Println("Error writing to CSV:", err)
-				return
+			if d := n.processingTime(); d > 0 {
+				select {
+				case <-time.After(d): // узел занят обработкой, очередь копится
+				case <-ctx.Done():
+				}
 			}
-
-			// Если узел не жив, игнорируем сообщение
-			if n.Alive == false {
-				color.Red("Node %d is NOT alive, ignoring message: %v\n", n.ID, msg)
-				continue
+			if err := n.handle(msg); err != nil {
+				fmt.Println("Error handling message:", err)
 			}
+		case name := <-n.Timers:
+			n.timer(name)
+		}
+	}
+}
 
-			if msg.Data == "lost" {
-				color.Red("Node %d didn't received a message: %v\n", n.ID, msg)
-				continue
+// drain handles the messages left in Incoming and releases pending timers without firing them.
+func (n *Node) drain() {
+	for {
+		select {
+		case msg := <-n.Incoming:
+			if err := n.handle(msg); err != nil {
+				fmt.Println("Error handling message:", err)
 			}
+		case <-n.Timers:
+			n.Pending.Done()
+		default:
+			return
+		}
+	}
+}
 
-			if msg.Data == "corrupted" {
-				color.Yellow("Node %d is alive, msg: %v\n", n.ID, msg)
-			} else {
-				color.Green("Node %d is alive, msg: %v\n", n.ID, msg)
-			}
+// Close flushes and closes the event log of the node.
+func (n *Node) Close() error {
+	if n.writer == nil {
+		return nil
+	}
+	n.writer.Mutex.Lock()
+	n.writer.Writer.Flush()
+	n.writer.Mutex.Unlock()
+	return n.file.Close()
+}
 
-			if msg.MessageID > n.DB.MessageID {
-				color.Green("Node %d received a new message with ID: (%d > %d), processing it\n", n.ID, msg.MessageID, n.DB.MessageID)
-				n.DB = msg // сохраняем сообщение в базе данных узла
-			} else {
-				color.Yellow("Node %d received a message with an old ID: (%d < %d), ignoring it\n", n.ID, msg.MessageID, n.DB.MessageID)
-			}
+// LogEvent writes a row about msg to the node's own event log.
+func (n *Node) LogEvent(msg *Message, msgType string) error {
+	return WriteToCSV(n.writer, n, msg, msgType)
+}
 
-			// отправляем сообщение обратно в канал Incoming
-			ResMsg := Message{
-				SenderID:  n.ID,          // Устанавливаем ID отправителя
-				Data:      msg.Data,      // Устанавливаем данные сообщения
-				MessageID: msg.MessageID, // Сохраняем ID сообщения
-			}
+// Deliver hands a message to the node: through Incoming when the node runs
+// as a goroutine, or handled immediately when the simulation uses virtual time.
+// A node with a processing time queues messages on the virtual clock too.
+func (n *Node) Deliver(msg Message) {
+	if sim.Virtual() {
+		if n.Processing != nil {
+			n.queue(msg)
+			return
+		}
+		if err := n.handle(msg); err != nil {
+			fmt.Println("Error handling message:", err)
+		}
+		return
+	}
+	n.enqueue(msg)
+}
+
+func (n *Node) handle(msg Message) error {
+	defer msg.settle()
 
-			msg.ResponseChan <- ResMsg // отправляем сообщение обратно в канал, если нужно
+	if msg.AckFor != 0 {
+		n.acked(msg)
+		return nil
+	}
+
+	// обработка сообщения
+	// Проверяем контрольную сумму: повреждённое сообщение помечаем и отклоняем ниже
+	if flags.Exper.Checksum && msg.Status != Lost && !msg.Valid() {
+		msg.Status = Corrupted
+	}
+
+	// Записываем в CSV
+	err := WriteToCSV(n.writer, n, &msg, "Receive")
+	if err != nil {
+		fmt.Println("Error writing to CSV:", err)
+		return err
+	}
+	if msg.Duplicate {
+		if err := WriteToCSV(n.writer, n, &msg, "Duplicate"); err != nil {
+			return err
 		}
 	}
+	if msg.Reordered {
+		if err := WriteToCSV(n.writer, n, &msg, "Reorder"); err != nil {
+			return err
+		}
+	}
+
+	// Если узел не жив, игнорируем сообщение
+	if !n.IsAlive() {
+		color.Red("Node %d is NOT alive, ignoring message: %v\n", n.ID, msg)
+		return nil
+	}
+
+	if msg.Status == Lost {
+		color.Red("Node %d didn't received a message: %v\n", n.ID, msg)
+		return nil
+	}
+
+	if !n.acknowledge(msg) {
+		return nil // повтор сообщения, которое узел уже обработал
+	}
+
+	n.handler().HandleMessage(n, msg) // дальше решает алгоритм
+	return nil
+}
+
+// IsAlive reports whether the node is currently up.
+func (n *Node) IsAlive() bool {
+	n.aliveMu.Lock()
+	defer n.aliveMu.Unlock()
+	return n.Alive
 }
 
-func NewCluster(size int) []*Node {
-	nodes := make([]*Node, size)
-	for i := range nodes {
-		nodes[i] = &Node{
-			ID:       i,
-			Alive:    true,
-			Incoming: make(chan Message, flags.Exper.NodeCount),
+// Crashed reports whether the node is down after a crash.
+func (n *Node) Crashed() bool {
+	n.aliveMu.Lock()
+	defer n.aliveMu.Unlock()
+	return n.crashed
+}
+
+// Crash takes the node down: until Recover it ignores every message and
+// sends nothing. With -crash-state keep the DB and the store survive the
+// crash; with snapshot they are lost and Recover reloads the last snapshot.
+func (n *Node) Crash() error {
+	return n.setAlive(false, "Crash")
+}
+
+// Recover brings a crashed node back up.
+func (n *Node) Recover() error {
+	return n.setAlive(true, "Recover")
+}
+
+// setAlive changes the liveness of the node and records the change in its event log.
+// The state lock is taken first, so that no message is stored between the
+// change of liveness and the loss or restore of the state.
+func (n *Node) setAlive(alive bool, event string) error {
+	n.stateMu.Lock()
+	n.aliveMu.Lock()
+	n.crashed = !alive
+	if n.Alive == alive {
+		n.aliveMu.Unlock()
+		n.stateMu.Unlock()
+		return nil
+	}
+	n.Alive = alive
+	n.aliveMu.Unlock()
+
+	var err error
+	if Persistent() {
+		if alive {
+			err = n.restore()
+		} else {
+			n.wipe()
 		}
 	}
-	// Связываем узлы в Peers
-	for _, n := range nodes {
-		n.Peers = nodes // в простом случае все знают всех
+	if alive {
+		n.recoveredAt = sim.Now()
+		n.catchUp() // снимок уже может содержать сообщение
+	}
+	n.stateMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if alive {
+		color.Cyan("Node %d recovered\n", n.ID)
+	} else {
+		color.Red("Node %d crashed\n", n.ID)
 	}
-	return nodes
+	if n.writer == nil {
+		return nil
+	}
+	db := n.Stored()
+	msg := Message{SenderID: n.ID, Data: db.Data, MessageID: db.MessageID}
+	return WriteToCSV(n.writer, n, &msg, event)
 }
 
 // CopyAlive copies the Alive state from old nodes to new nodes by matching IDs.
@@ -142,7 +378,7 @@ func InitCSVFiles(N int) error {
 
 		// Write headers to CSV
 		writer := csv.NewWriter(file) // Create a CSV writer
-		err = writer.Write([]string{"Experiment ID", "Time", "Node ID", "Alive Node", "Sender ID", "Receiver ID", "Messages Data", "Message ID", "Node DB", "Message Type"})
+		err = writer.Write([]string{"Experiment ID", "Time", "Node ID", "Alive Node", "Sender ID", "Receiver ID", "Messages Data", "Message ID", "Node DB", "Message Type", "Lamport", "Message Lamport", "Vector Clock", "Message Vector"})
 		if err != nil {
 			fmt.Println("Error writing CSV header:", err)
 			return err
@@ -157,22 +393,32 @@ func InitCSVFiles(N int) error {
 	return nil
 }
 
+// WriteToCSV logs an event of the node. The row carries the logical clocks of
+// the node after the event; a sent message is stamped with them first.
 func WriteToCSV(writer *SafeWriter, n *Node, msg *Message, msgType string) error {
+	db := n.Stored() // до журнала: состояние узла не блокируется вместе с ним
 
 	writer.Mutex.Lock()
 	defer writer.Mutex.Unlock()
 
+	n.tick(msg, msgType)
+	lamport, vector := n.clocks()
+
 	err := writer.Writer.Write([]string{
-		fmt.Sprintf("%d", flags.Exper.ID),                  // Experiment ID
-		time.Now().Format("2006-01-02 15:04:05.000000000"), // Time
-		fmt.Sprintf("%v", n.ID),                            // Node ID
-		fmt.Sprintf("%v", n.Alive),                         // Number of alive nodes
-		fmt.Sprintf("%d", msg.SenderID),                    // Sender ID
-		fmt.Sprintf("%d", n.ID),                            // Receiver ID
-		fmt.Sprintf("%s", msg.Data),                        // Message data
-		fmt.Sprintf("%d", msg.MessageID),                   // Message data
-		fmt.Sprintf("%s", n.DB.Data),                       // Node DB
-		fmt.Sprintf("%s", msgType),                         // Type of message (Send, Receive, etc.)
+		fmt.Sprintf("%d", flags.Exper.ID),                 // Experiment ID
+		sim.Now().Format("2006-01-02 15:04:05.000000000"), // Time
+		fmt.Sprintf("%v", n.ID),                           // Node ID
+		fmt.Sprintf("%v", n.IsAlive()),                    // Number of alive nodes
+		fmt.Sprintf("%d", msg.SenderID),                   // Sender ID
+		fmt.Sprintf("%d", n.ID),                           // Receiver ID
+		msg.Label(),                                       // Message data or delivery status
+		fmt.Sprintf("%d", msg.MessageID),                  // Message data
+		fmt.Sprintf("%s", db.Data),                        // Node DB
+		fmt.Sprintf("%s", msgType),                        // Type of message (Send, Receive, etc.)
+		fmt.Sprintf("%d", lamport),                        // Lamport time of the node
+		fmt.Sprintf("%d", msg.Lamport),                    // Lamport time of the sender
+		formatVector(vector),                              // Vector clock of the node
+		formatVector(msg.Vector),                          // Vector clock of the sender
 	})
 	if err != nil {
 		fmt.Println("Error writing to CSV:", err)
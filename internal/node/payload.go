@@ -0,0 +1,67 @@
+package node
+
+import (
+	"bytes"
+	"hash/crc32"
+	"maps"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+)
+
+// NewMessage creates an original data message whose payload is protected by
+// a CRC-32 checksum. Its declared size is the -msg-size of the experiment.
+func NewMessage(senderID, messageID int, data string) Message {
+	payload := []byte(data)
+	return Message{
+		Type:      TypeData,
+		Size:      flags.Exper.MessageSize,
+		SenderID:  senderID,
+		Data:      data,
+		MessageID: messageID,
+		Payload:   payload,
+		Checksum:  crc32.ChecksumIEEE(payload),
+	}
+}
+
+// Originate stores a message the node itself creates, as the source of the
+// dissemination, and persists it like any other change of its DB.
+func (n *Node) Originate(msg Message) {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	before := n.mark()
+	n.DB = msg
+	n.persistChange(before)
+}
+
+// Valid reports whether the payload matches its checksum.
+func (m Message) Valid() bool {
+	return crc32.ChecksumIEEE(m.Payload) == m.Checksum
+}
+
+// Stored returns the message held in the node's DB. Deliveries and crashes
+// change the DB while the simulation runs, so everything outside the node
+// reads it through Stored.
+func (n *Node) Stored() Message {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	return n.DB
+}
+
+// Rumor returns a copy of the message stored in the node's DB, together with
+// the entries of the node's store, ready to be forwarded by the node. The payload is sent as stored, so a corruption that
+// was not detected travels further.
+func (n *Node) Rumor() Message {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	msg := n.DB
+	msg.SenderID = n.ID
+	msg.ResponseChan = nil
+	msg.tracker = nil
+	msg.Duplicate = false
+	msg.Reordered = false
+	msg.Replayed = false
+	msg.Header = maps.Clone(n.DB.Header)
+	msg.Payload = bytes.Clone(n.DB.Payload)
+	msg.Entries = n.Store.Entries()
+	return msg
+}
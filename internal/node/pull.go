@@ -0,0 +1,30 @@
+package node
+
+// PullRequest creates a request for whatever the node is missing. It carries
+// a digest of what the node holds: the MessageID of its message (0 without
+// one) and the versions of its entries without their values.
+func (n *Node) PullRequest() Message {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	req := Message{Type: TypePullRequest, SenderID: n.ID}
+	if n.DB.Data != "" {
+		req.MessageID = n.DB.MessageID
+	}
+	for _, e := range n.Store.Entries() {
+		e.Value = "" // в сводке только версии
+		req.Entries = append(req.Entries, e)
+	}
+	return req
+}
+
+// Missing reports whether the node holds something the digest of a pull
+// request lacks: a newer message or a newer version of some key.
+func (n *Node) Missing(req Message) bool {
+	db := n.Stored()
+	if db.Data != "" && db.MessageID > req.MessageID {
+		return true
+	}
+	var digest Store
+	digest.Merge(req.Entries)
+	return !digest.Covers(n.Store.Entries())
+}
@@ -0,0 +1,172 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// What survives a crash of a node.
+const (
+	CrashStateKeep     = "keep"     // всё состояние переживает отказ
+	CrashStateSnapshot = "snapshot" // остаётся только последний снимок на диске
+)
+
+// snapshot is the persisted state of a node. Delivery bookkeeping (response
+// channels, trackers, network flags) is not part of it.
+type snapshot struct {
+	Type      string
+	SenderID  int
+	Data      string
+	MessageID int
+	Header    map[string]string
+	Payload   []byte
+	Size      int
+	Checksum  uint32
+	Corrupted bool
+	Forged    bool
+	Entries   []Entry
+}
+
+// Persistent reports whether crashes of the experiment lose the state that
+// has not been snapshotted.
+func Persistent() bool {
+	return flags.Exper.CrashState == CrashStateSnapshot
+}
+
+// SnapshotPath is the file the node persists its state to. It is not a .csv
+// file, so the aggregation of event logs leaves it alone.
+func (n *Node) SnapshotPath() string {
+	return fmt.Sprintf("metrics/node_%d.snapshot", n.ID)
+}
+
+// Snapshot writes the DB and the key-value store of the node to its snapshot file.
+func (n *Node) Snapshot() error {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	return n.snapshot()
+}
+
+// snapshot must be called with n.stateMu held.
+func (n *Node) snapshot() error {
+	s := snapshot{
+		Type:      n.DB.Type,
+		SenderID:  n.DB.SenderID,
+		Data:      n.DB.Data,
+		MessageID: n.DB.MessageID,
+		Header:    n.DB.Header,
+		Payload:   n.DB.Payload,
+		Size:      n.DB.Size,
+		Checksum:  n.DB.Checksum,
+		Corrupted: n.DB.Corrupted,
+		Forged:    n.DB.Forged,
+		Entries:   n.Store.Entries(),
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode snapshot of node %d: %w", n.ID, err)
+	}
+	// пишем во временный файл и переименовываем, чтобы отказ не оставил половину снимка
+	tmp := n.SnapshotPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write snapshot of node %d: %w", n.ID, err)
+	}
+	return os.Rename(tmp, n.SnapshotPath())
+}
+
+// wipe drops the volatile state of a crashed node.
+// Must be called with n.stateMu held.
+func (n *Node) wipe() {
+	n.DB = Message{}
+	n.Store.reset()
+	n.endorsements = nil
+	n.replay = nil
+}
+
+// restore reloads the last snapshot of the node; without one it starts empty.
+// Must be called with n.stateMu held.
+func (n *Node) restore() error {
+	data, err := os.ReadFile(n.SnapshotPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot of node %d: %w", n.ID, err)
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("decode snapshot of node %d: %w", n.ID, err)
+	}
+	n.DB = Message{
+		Type:      s.Type,
+		SenderID:  s.SenderID,
+		Data:      s.Data,
+		MessageID: s.MessageID,
+		Header:    s.Header,
+		Payload:   s.Payload,
+		Size:      s.Size,
+		Checksum:  s.Checksum,
+		Corrupted: s.Corrupted,
+		Forged:    s.Forged,
+	}
+	n.Store.load(s.Entries)
+	return nil
+}
+
+// RemoveSnapshot deletes the snapshot file of the node.
+func (n *Node) RemoveSnapshot() error {
+	err := os.Remove(n.SnapshotPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// stateMark identifies the persisted state of the node, so that a change
+// can be detected without comparing the state itself.
+type stateMark struct {
+	messageID int
+	checksum  uint32
+	changes   int
+}
+
+func (n *Node) mark() stateMark {
+	return stateMark{n.DB.MessageID, n.DB.Checksum, n.Store.changes()}
+}
+
+// persistChange snapshots the node if its state changed since before and
+// every change is persisted right away (-snapshot-interval 0).
+// Must be called with n.stateMu held.
+func (n *Node) persistChange(before stateMark) {
+	if !Persistent() || flags.Exper.SnapshotInterval > 0 || n.mark() == before {
+		return
+	}
+	if err := n.snapshot(); err != nil {
+		fmt.Println("Error writing snapshot:", err)
+	}
+}
+
+// CatchingUp reports whether the node has recovered but does not hold the
+// message yet.
+func (n *Node) CatchingUp() bool {
+	n.stateMu.Lock()
+	defer n.stateMu.Unlock()
+	return !n.recoveredAt.IsZero()
+}
+
+// catchUp records how long the node took after its last recovery to hold the
+// message again.
+// Must be called with n.stateMu held.
+func (n *Node) catchUp() {
+	if n.recoveredAt.IsZero() || n.DB.Data != "OK" {
+		return
+	}
+	n.CatchUps = append(n.CatchUps, sim.Now().Sub(n.recoveredAt))
+	n.recoveredAt = time.Time{}
+}
@@ -0,0 +1,92 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// wireMessage is what a Message looks like on a real network. Response
+// channels and delivery tracking belong to the sending process and are not
+// sent, and neither is the delivery status, which the receiving side sets.
+type wireMessage struct {
+	Type      string `json:",omitempty"`
+	SenderID  int
+	Data      string `json:",omitempty"`
+	MessageID int
+	Header    map[string]string `json:",omitempty"`
+	Payload   []byte            `json:",omitempty"`
+	Size      int               `json:",omitempty"`
+	Checksum  uint32
+	Entries   []Entry `json:",omitempty"`
+	Lamport   int
+	Vector    []int  `json:",omitempty"`
+	Seq       uint64 `json:",omitempty"`
+	AckFor    uint64 `json:",omitempty"`
+	Corrupted bool   `json:",omitempty"`
+	Forged    bool   `json:",omitempty"`
+	Replayed  bool   `json:",omitempty"`
+}
+
+// Marshal encodes the message for sending over a socket. The encoding is
+// padded with whitespace up to the declared Size, so that a message takes as
+// many bytes on the wire as the experiment says it does.
+func (m Message) Marshal() ([]byte, error) {
+	data, err := json.Marshal(wireMessage{
+		Type:      m.Type,
+		SenderID:  m.SenderID,
+		Data:      m.Data,
+		MessageID: m.MessageID,
+		Header:    m.Header,
+		Payload:   m.Payload,
+		Size:      m.Size,
+		Checksum:  m.Checksum,
+		Entries:   m.Entries,
+		Lamport:   m.Lamport,
+		Vector:    m.Vector,
+		Seq:       m.Seq,
+		AckFor:    m.AckFor,
+		Corrupted: m.Corrupted,
+		Forged:    m.Forged,
+		Replayed:  m.Replayed,
+	})
+	if err != nil || len(data) >= m.Size {
+		return data, err
+	}
+	// пробелы после JSON допустимы, Unmarshal их пропускает
+	return append(data, bytes.Repeat([]byte(" "), m.Size-len(data))...), nil
+}
+
+// Unmarshal decodes a message received from a socket.
+func Unmarshal(data []byte) (Message, error) {
+	var w wireMessage
+	if err := json.Unmarshal(data, &w); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Type:      w.Type,
+		SenderID:  w.SenderID,
+		Data:      w.Data,
+		MessageID: w.MessageID,
+		Header:    w.Header,
+		Payload:   w.Payload,
+		Size:      w.Size,
+		Checksum:  w.Checksum,
+		Entries:   w.Entries,
+		Lamport:   w.Lamport,
+		Vector:    w.Vector,
+		Seq:       w.Seq,
+		AckFor:    w.AckFor,
+		Corrupted: w.Corrupted,
+		Forged:    w.Forged,
+		Replayed:  w.Replayed,
+	}, nil
+}
+
+// Attach gives a message decoded from the wire the parts of the original
+// that stay in the sending process: the response channel and the tracking
+// of Node.Send. Senders and receivers share the process, so the reply still
+// reaches the sender.
+func (m *Message) Attach(orig Message) {
+	m.ResponseChan = orig.ResponseChan
+	m.tracker = orig.tracker
+}
@@ -0,0 +1,198 @@
+// Package reliable is an optional delivery layer between the dissemination
+// algorithms and the network. Every message gets a sequence number and is
+// retransmitted until the receiver acknowledges it, with a timeout that grows
+// exponentially after every attempt, or until the retries run out. The
+// acknowledgements travel through the same lossy network.
+//
+// Retransmissions, sent acknowledgements and messages given up on are written
+// to the event logs of the nodes as Retransmit, Ack and GiveUp rows.
+package reliable
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// Transport makes the transport below it reliable. It implements
+// node.Transport and node.Acknowledger.
+type Transport struct {
+	Net     node.Transport
+	Retries int           // повторные попытки после первой
+	Timeout time.Duration // ожидание подтверждения первой попытки
+	Backoff float64       // множитель таймаута после каждой попытки
+
+	mu       sync.Mutex
+	seq      uint64
+	pending  map[uint64]*delivery
+	received map[uint64]bool // сообщения, уже переданные получателю
+	inflight sync.WaitGroup  // копии в сети; завершение отслеживает wg отправителя
+}
+
+// delivery is a message waiting for its acknowledgement.
+type delivery struct {
+	sender, receiver *node.Node
+	msg              node.Message
+	wg               *sync.WaitGroup
+	attempt          int
+	stop             func() // отменяет таймер текущей попытки
+	done             bool
+}
+
+// New creates the reliable layer from the experiment parameters.
+func New(net node.Transport, exper flags.Experiment) (*Transport, error) {
+	if exper.Retries < 0 {
+		return nil, fmt.Errorf("retries must not be negative")
+	}
+	if exper.AckTimeout <= 0 {
+		return nil, fmt.Errorf("ack timeout must be positive")
+	}
+	if exper.Backoff < 1 {
+		return nil, fmt.Errorf("backoff must be at least 1")
+	}
+	t := &Transport{
+		Net:     net,
+		Retries: exper.Retries,
+		Timeout: time.Duration(exper.AckTimeout * float64(time.Millisecond)),
+		Backoff: exper.Backoff,
+	}
+	t.Reset()
+	return t, nil
+}
+
+// Reset forgets the messages of the previous simulation.
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = make(map[uint64]*delivery)
+	t.received = make(map[uint64]bool)
+}
+
+// MaxWait is how long a message can take to be acknowledged or given up on.
+func (t *Transport) MaxWait() time.Duration {
+	var total time.Duration
+	for k := 0; k <= t.Retries; k++ {
+		total += t.timeout(k)
+	}
+	return total
+}
+
+// timeout is the wait for the acknowledgement of attempt k.
+func (t *Transport) timeout(k int) time.Duration {
+	return time.Duration(float64(t.Timeout) * math.Pow(t.Backoff, float64(k)))
+}
+
+// Send sends msg and keeps retransmitting it until it is acknowledged or the
+// retries run out; only then wg is released.
+func (t *Transport) Send(sender *node.Node, receiver *node.Node, msg node.Message, wg *sync.WaitGroup) {
+	t.mu.Lock()
+	t.seq++
+	msg.Seq = t.seq
+	d := &delivery{sender: sender, receiver: receiver, msg: msg, wg: wg}
+	t.pending[msg.Seq] = d
+	t.mu.Unlock()
+
+	t.transmit(d)
+}
+
+// transmit sends the current attempt of d and arms its timeout.
+// Must not be called with t.mu held.
+func (t *Transport) transmit(d *delivery) {
+	t.mu.Lock()
+	k := d.attempt
+	msg := d.msg
+	d.stop = t.after(t.timeout(k), func() { t.expire(d, k) })
+	t.mu.Unlock()
+
+	t.inflight.Add(1)
+	sim.Go(func() { t.Net.Send(d.sender, d.receiver, msg, &t.inflight) })
+}
+
+// expire retransmits d if attempt k is still unacknowledged.
+func (t *Transport) expire(d *delivery, k int) {
+	t.mu.Lock()
+	if d.done || d.attempt != k {
+		t.mu.Unlock()
+		return
+	}
+	if k >= t.Retries || d.sender.Crashed() {
+		// попытки кончились или отправитель упал: сообщение не доставлено
+		t.finish(d)
+		t.mu.Unlock()
+		if err := d.sender.LogEvent(&d.msg, "GiveUp"); err != nil {
+			fmt.Println("Error writing to CSV:", err)
+		}
+		return
+	}
+	d.attempt++
+	t.mu.Unlock()
+
+	if err := d.sender.LogEvent(&d.msg, "Retransmit"); err != nil {
+		fmt.Println("Error writing to CSV:", err)
+	}
+	t.transmit(d)
+}
+
+// finish releases the sender of d. Must be called with t.mu held.
+func (t *Transport) finish(d *delivery) {
+	d.done = true
+	if d.stop != nil {
+		d.stop()
+	}
+	delete(t.pending, d.msg.Seq)
+	d.wg.Done()
+}
+
+// Acknowledge answers a message that reached n intact and reports whether
+// it is new to n; retransmissions of a message n already has are not handled
+// again. A corrupted copy is not acknowledged, so that it is sent again.
+func (t *Transport) Acknowledge(n *node.Node, msg node.Message) bool {
+	if msg.Status == node.Corrupted {
+		return true
+	}
+
+	t.mu.Lock()
+	fresh := !t.received[msg.Seq]
+	t.received[msg.Seq] = true
+	d := t.pending[msg.Seq]
+	t.mu.Unlock()
+	if d == nil {
+		return fresh // отправитель уже сдался, подтверждать некому
+	}
+
+	ack := node.Message{Type: node.TypeAck, SenderID: n.ID, MessageID: msg.MessageID, AckFor: msg.Seq}
+	if err := n.LogEvent(&ack, "Ack"); err != nil {
+		fmt.Println("Error writing to CSV:", err)
+	}
+	t.inflight.Add(1)
+	sim.Go(func() { t.Net.Send(n, d.sender, ack, &t.inflight) })
+	return fresh
+}
+
+// Acked completes the delivery an acknowledgement that reached n is for.
+func (t *Transport) Acked(n *node.Node, ack node.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.pending[ack.AckFor]
+	if d == nil || d.done || d.sender != n {
+		return // повторное или запоздалое подтверждение
+	}
+	t.finish(d)
+}
+
+// after runs fn after d. On the virtual clock the timeout is a regular event,
+// so the simulation keeps running until every message is settled; the
+// returned function only matters in real time.
+func (t *Transport) after(d time.Duration, fn func()) func() {
+	if sim.Virtual() {
+		sim.Delay(d, fn)
+		return nil
+	}
+	timer := time.AfterFunc(d, fn)
+	return func() { timer.Stop() }
+}
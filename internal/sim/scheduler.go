@@ -0,0 +1,164 @@
+package sim
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// event is a callback scheduled at a point of virtual time.
+type event struct {
+	at     time.Duration
+	seq    uint64 // порядок добавления: события с одинаковым временем выполняются по очереди
+	fn     func()
+	daemon bool // фоновое событие не удерживает Run
+	stop   bool
+}
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at == q[j].at {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at < q[j].at
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) { *q = append(*q, x.(*event)) }
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Scheduler is a discrete-event engine with a virtual clock.
+// Events run one at a time in timestamp order; the clock jumps from one
+// event to the next instead of waiting in real time.
+type Scheduler struct {
+	mu     sync.Mutex
+	epoch  time.Time
+	now    time.Duration
+	seq    uint64
+	queue  eventQueue
+	active int // запланированные события, которые не являются фоновыми
+}
+
+// NewScheduler creates a scheduler whose virtual time zero corresponds to epoch.
+func NewScheduler(epoch time.Time) *Scheduler {
+	return &Scheduler{epoch: epoch}
+}
+
+// Now returns the elapsed virtual time.
+func (s *Scheduler) Now() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+// Time returns the current virtual time as a wall-clock timestamp.
+func (s *Scheduler) Time() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.epoch.Add(s.now)
+}
+
+// After schedules fn to run d after the current virtual time.
+func (s *Scheduler) After(d time.Duration, fn func()) {
+	s.schedule(d, fn, false)
+}
+
+// AfterDaemon schedules a background event, such as a failure timer. Daemon
+// events run when the clock reaches them but do not keep Run going, and the
+// returned function cancels the event if it has not run yet.
+func (s *Scheduler) AfterDaemon(d time.Duration, fn func()) (stop func() bool) {
+	e := s.schedule(d, fn, true)
+	return func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if e.stop || e.fn == nil {
+			return false
+		}
+		e.stop = true
+		return true
+	}
+}
+
+func (s *Scheduler) schedule(d time.Duration, fn func(), daemon bool) *event {
+	if d < 0 {
+		d = 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	e := &event{at: s.now + d, seq: s.seq, fn: fn, daemon: daemon}
+	heap.Push(&s.queue, e)
+	if !daemon {
+		s.active++
+	}
+	return e
+}
+
+// Pending returns the number of scheduled events.
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Step runs the next event if it is due no later than deadline and reports
+// whether an event was run. Otherwise the clock is moved to the deadline.
+func (s *Scheduler) Step(deadline time.Duration) bool {
+	s.mu.Lock()
+	if len(s.queue) == 0 || s.queue[0].at > deadline {
+		if deadline > s.now {
+			s.now = deadline
+		}
+		s.mu.Unlock()
+		return false
+	}
+	e := heap.Pop(&s.queue).(*event)
+	if e.at > s.now {
+		s.now = e.at
+	}
+	if !e.daemon {
+		s.active--
+	}
+	fn := e.fn
+	e.fn = nil // событие выполнено, отменять его поздно
+	stopped := e.stop
+	s.mu.Unlock()
+
+	if !stopped {
+		fn()
+	}
+	return true
+}
+
+// RunFor processes events for d of virtual time.
+func (s *Scheduler) RunFor(d time.Duration) {
+	deadline := s.Now() + d
+	for s.Step(deadline) {
+	}
+}
+
+// Run processes events until no regular events are left. Daemon events due
+// before the last regular event run in order; later ones stay queued.
+func (s *Scheduler) Run() {
+	for {
+		s.mu.Lock()
+		if s.active == 0 {
+			s.mu.Unlock()
+			return
+		}
+		next := s.queue[0].at
+		s.mu.Unlock()
+		s.Step(next)
+	}
+}
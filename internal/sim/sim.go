@@ -0,0 +1,152 @@
+// Package sim abstracts the passage of time for the simulation.
+//
+// In real-time mode (the default) the helpers are thin wrappers around
+// goroutines, time.Sleep and time.After. In virtual-time mode everything runs
+// on a single discrete-event Scheduler: sends become scheduled events, waits
+// advance the virtual clock, and timestamps in the event log are simulated time.
+package sim
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	mu      sync.Mutex
+	virtual bool
+	current = NewScheduler(time.Now())
+)
+
+// UseVirtualTime switches the simulation between real and virtual time.
+func UseVirtualTime(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	virtual = enabled
+}
+
+// Virtual reports whether the simulation runs on the virtual clock.
+func Virtual() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return virtual
+}
+
+// Reset starts a fresh virtual clock for the next simulation.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	current = NewScheduler(time.Now())
+}
+
+// Current returns the scheduler of the running simulation.
+func Current() *Scheduler {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// Now returns the simulation time used for timestamps.
+func Now() time.Time {
+	if !Virtual() {
+		return time.Now()
+	}
+	return Current().Time()
+}
+
+// Go runs fn concurrently in real time. On the virtual clock it runs inline,
+// because all concurrency is expressed through scheduled events.
+func Go(fn func()) {
+	if !Virtual() {
+		go fn()
+		return
+	}
+	fn()
+}
+
+// Delay runs fn after d. In real time the calling goroutine sleeps and then
+// calls fn; on the virtual clock fn is scheduled as an event and Delay returns immediately.
+func Delay(d time.Duration, fn func()) {
+	if !Virtual() {
+		time.Sleep(d)
+		fn()
+		return
+	}
+	Current().After(d, fn)
+}
+
+// Recv waits up to timeout for a value from ch. On the virtual clock it
+// processes events until the value arrives or the timeout expires in virtual time.
+func Recv[T any](ch <-chan T, timeout time.Duration) (T, bool) {
+	if !Virtual() {
+		select {
+		case v := <-ch:
+			return v, true
+		case <-time.After(timeout):
+			var zero T
+			return zero, false
+		}
+	}
+
+	s := Current()
+	deadline := s.Now() + timeout
+	for {
+		select {
+		case v := <-ch:
+			return v, true
+		default:
+		}
+		if !s.Step(deadline) {
+			select {
+			case v := <-ch:
+				return v, true
+			default:
+				var zero T
+				return zero, false
+			}
+		}
+	}
+}
+
+// Wait waits for wg. On the virtual clock all pending events are processed first,
+// so every message in flight is delivered before Wait returns.
+func Wait(wg *sync.WaitGroup) {
+	if Virtual() {
+		Current().Run()
+	}
+	wg.Wait()
+}
+
+// Timer is a pending callback created by AfterFunc.
+type Timer struct {
+	stop func() bool
+}
+
+// Stop cancels the timer and reports whether it was still pending.
+func (t *Timer) Stop() bool {
+	return t.stop()
+}
+
+// AfterFunc calls fn after d in the background. In real time this is
+// time.AfterFunc; on the virtual clock fn is a daemon event, so pending timers
+// (node failures, for example) never keep Wait from returning.
+func AfterFunc(d time.Duration, fn func()) *Timer {
+	if !Virtual() {
+		return &Timer{stop: time.AfterFunc(d, fn).Stop}
+	}
+	return &Timer{stop: Current().AfterDaemon(d, fn)}
+}
+
+// TrySend sends v on ch. In real time it blocks like a plain channel send;
+// on the virtual clock nobody else can drain ch, so a full channel drops v.
+func TrySend[T any](ch chan<- T, v T) bool {
+	if !Virtual() {
+		ch <- v
+		return true
+	}
+	select {
+	case ch <- v:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,411 @@
+// Package socket is a transport over real kernel networking. Every node
+// listens on its own localhost UDP or TCP port, and messages are serialized,
+// written to the port of the receiver and decoded there, so that simulated
+// results can be checked against a real network stack.
+//
+// The nodes still share one process: the response channel and the delivery
+// tracking of a message stay behind in a table of frames in flight, and the
+// receiving side attaches them again by the frame number sent on the wire.
+// A frame that does not arrive within the delivery timeout (UDP can drop
+// datagrams when a socket buffer is full) is delivered as lost, the way the
+// network simulator delivers lost messages.
+//
+// The socket transport runs only in real time.
+package socket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/network"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+)
+
+// Transports selectable with -transport.
+const (
+	Simulated = "sim" // сообщения идут через симулятор сети
+	UDP       = "udp"
+	TCP       = "tcp"
+)
+
+// DeliveryTimeout is how long a frame may take before it counts as lost.
+const DeliveryTimeout = time.Second
+
+const (
+	refSize      = 8     // номер кадра перед сообщением
+	maxFrameSize = 65507 // больше не помещается в датаграмму UDP
+)
+
+// Stats are the serialization counters of one simulation.
+type Stats struct {
+	Frames     int           // закодированные сообщения
+	Bytes      int64         // байты, записанные в сокеты
+	EncodeTime time.Duration // суммарное время кодирования
+	Decoded    int           // раскодированные сообщения
+	DecodeTime time.Duration // суммарное время декодирования
+}
+
+// Transport sends messages through localhost sockets. It implements node.Transport.
+type Transport struct {
+	Network string // UDP или TCP
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	addrs     map[int]net.Addr
+	packets   map[int]net.PacketConn // UDP: узел и отправляет, и принимает через свой сокет
+	listeners []net.Listener
+	conns     map[[2]int]*stream // TCP: соединение на пару отправитель-получатель
+	accepted  []net.Conn
+	frames    map[uint64]*frame
+	ref       uint64
+	stats     Stats
+	quit      chan struct{}
+	readers   sync.WaitGroup
+}
+
+// frame is a message on its way through a socket.
+type frame struct {
+	orig node.Message
+	done chan struct{}
+}
+
+// stream is a TCP connection that several senders may write to.
+type stream struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// New creates the socket transport of the experiment.
+func New(exper flags.Experiment) (*Transport, error) {
+	if exper.Transport != UDP && exper.Transport != TCP {
+		return nil, fmt.Errorf("unknown transport %q (sim, udp or tcp)", exper.Transport)
+	}
+	if exper.VirtualTime {
+		return nil, fmt.Errorf("the %s transport runs only in real time (drop -virtual)", exper.Transport)
+	}
+	return &Transport{Network: exper.Transport, Timeout: DeliveryTimeout}, nil
+}
+
+// Ignored lists the flags of the experiment that only the network simulator
+// applies: over sockets delays, losses, corruption, partitions, bandwidth,
+// duplicates and reordering are up to the real network.
+func Ignored(exper flags.Experiment) []string {
+	checks := []struct {
+		flag string
+		set  bool
+	}{
+		{"-delay", exper.DelayMean > 0},
+		{"-delay-dist", exper.DelayDistribution != network.DelayUniform},
+		{"-links", exper.LinkModel != network.LinksUniform},
+		{"-link-file", exper.LinkFile != ""},
+		{"-inter-delay", exper.InterDelayMean >= 0},
+		{"-inter-loss", exper.InterLoss >= 0},
+		{"-inter-corrupt", exper.InterCorruption >= 0},
+		{"-loss", exper.LossProbability > 0},
+		{"-corrupt", exper.CorruptionProbability > 0},
+		{"-loss-model", exper.LossModel != network.LossBernoulli},
+		{"-partitions", exper.Partitions != ""},
+		{"-uplink", exper.UplinkMbps > 0},
+		{"-downlink", exper.DownlinkMbps > 0},
+		{"-dup", exper.DuplicateProbability > 0},
+		{"-reorder", exper.ReorderProbability > 0},
+	}
+	var ignored []string
+	for _, c := range checks {
+		if c.set {
+			ignored = append(ignored, c.flag)
+		}
+	}
+	return ignored
+}
+
+// Start opens a localhost port for every node of a new simulation.
+func (t *Transport) Start(nodes []*node.Node) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.addrs = make(map[int]net.Addr)
+	t.packets = make(map[int]net.PacketConn)
+	t.listeners = nil
+	t.conns = make(map[[2]int]*stream)
+	t.accepted = nil
+	t.frames = make(map[uint64]*frame)
+	t.ref = 0
+	t.stats = Stats{}
+	t.quit = make(chan struct{})
+
+	for _, n := range nodes {
+		if err := t.listen(n); err != nil {
+			t.closeLocked()
+			return fmt.Errorf("listen for node %d: %w", n.ID, err)
+		}
+	}
+	return nil
+}
+
+// listen opens the port of n. Must be called with t.mu held.
+func (t *Transport) listen(n *node.Node) error {
+	if t.Network == UDP {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		t.packets[n.ID] = pc
+		t.addrs[n.ID] = pc.LocalAddr()
+		t.readers.Add(1)
+		go t.readPackets(n, pc)
+		return nil
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	t.listeners = append(t.listeners, l)
+	t.addrs[n.ID] = l.Addr()
+	t.readers.Add(1)
+	go t.accept(n, l)
+	return nil
+}
+
+// Close closes every port and connection, delivers the frames still in
+// flight as lost and waits for the readers to finish.
+func (t *Transport) Close() {
+	t.mu.Lock()
+	t.closeLocked()
+	t.mu.Unlock()
+	t.readers.Wait()
+}
+
+// closeLocked must be called with t.mu held.
+func (t *Transport) closeLocked() {
+	if t.quit != nil {
+		close(t.quit)
+		t.quit = nil
+	}
+	for _, pc := range t.packets {
+		pc.Close()
+	}
+	for _, l := range t.listeners {
+		l.Close()
+	}
+	for _, s := range t.conns {
+		s.conn.Close()
+	}
+	for _, c := range t.accepted {
+		c.Close()
+	}
+}
+
+// Stats returns the serialization counters of the running simulation.
+func (t *Transport) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+// Send serializes msg, writes it to the port of the receiver and waits until
+// the receiver got it or it is lost.
+func (t *Transport) Send(sender *node.Node, receiver *node.Node, msg node.Message, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	start := time.Now()
+	payload, err := msg.Marshal()
+	encode := time.Since(start)
+	if err != nil {
+		fmt.Println("Error encoding message:", err)
+		t.deliverLost(receiver, msg)
+		return
+	}
+	if refSize+len(payload) > maxFrameSize {
+		fmt.Printf("Message from node %d to node %d is too large for a frame (%d bytes)\n", sender.ID, receiver.ID, len(payload))
+		t.deliverLost(receiver, msg)
+		return
+	}
+
+	t.mu.Lock()
+	if t.quit == nil {
+		t.mu.Unlock()
+		t.deliverLost(receiver, msg) // транспорт уже закрыт
+		return
+	}
+	t.ref++
+	ref := t.ref
+	f := &frame{orig: msg, done: make(chan struct{})}
+	t.frames[ref] = f
+	t.stats.Frames++
+	t.stats.EncodeTime += encode
+	t.stats.Bytes += int64(refSize + len(payload))
+	quit := t.quit
+	t.mu.Unlock()
+
+	data := make([]byte, refSize+len(payload))
+	binary.BigEndian.PutUint64(data, ref)
+	copy(data[refSize:], payload)
+
+	if err := t.write(sender.ID, receiver.ID, data); err != nil {
+		flags.VPrintln("Error writing frame:", err)
+		t.lose(ref, receiver, f)
+		return
+	}
+
+	timer := time.NewTimer(t.Timeout)
+	defer timer.Stop()
+	select {
+	case <-f.done:
+	case <-timer.C:
+		t.lose(ref, receiver, f)
+	case <-quit:
+		t.lose(ref, receiver, f)
+	}
+}
+
+// write sends one frame from node from to node to.
+func (t *Transport) write(from, to int, data []byte) error {
+	t.mu.Lock()
+	addr := t.addrs[to]
+	if t.Network == UDP {
+		pc := t.packets[from]
+		t.mu.Unlock()
+		if pc == nil || addr == nil {
+			return fmt.Errorf("no socket for %d -> %d", from, to)
+		}
+		_, err := pc.WriteTo(data, addr)
+		return err
+	}
+
+	key := [2]int{from, to}
+	s := t.conns[key]
+	if s == nil {
+		if addr == nil {
+			t.mu.Unlock()
+			return fmt.Errorf("no port for node %d", to)
+		}
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.mu.Unlock()
+			return err
+		}
+		s = &stream{conn: conn}
+		t.conns[key] = s
+	}
+	t.mu.Unlock()
+
+	// кадр TCP: длина, затем номер и сообщение
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.conn.Write(buf)
+	return err
+}
+
+// readPackets receives the datagrams sent to n until its socket is closed.
+func (t *Transport) readPackets(n *node.Node, pc net.PacketConn) {
+	defer t.readers.Done()
+	buf := make([]byte, maxFrameSize)
+	for {
+		k, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		t.receive(n, buf[:k])
+	}
+}
+
+// accept takes the connections to the port of n until it is closed.
+func (t *Transport) accept(n *node.Node, l net.Listener) {
+	defer t.readers.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		t.mu.Lock()
+		if t.quit == nil {
+			t.mu.Unlock()
+			conn.Close()
+			return
+		}
+		t.accepted = append(t.accepted, conn)
+		t.readers.Add(1)
+		t.mu.Unlock()
+		go t.readStream(n, conn)
+	}
+}
+
+// readStream receives the frames of one TCP connection to n.
+func (t *Transport) readStream(n *node.Node, conn net.Conn) {
+	defer t.readers.Done()
+	r := bufio.NewReader(conn)
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				flags.VPrintln("Error reading frame:", err)
+			}
+			return
+		}
+		t.receive(n, data)
+	}
+}
+
+// receive decodes a frame that reached n and hands the message to the node.
+func (t *Transport) receive(n *node.Node, data []byte) {
+	if len(data) < refSize {
+		return
+	}
+	ref := binary.BigEndian.Uint64(data)
+
+	start := time.Now()
+	msg, err := node.Unmarshal(data[refSize:])
+	decode := time.Since(start)
+	if err != nil {
+		fmt.Println("Error decoding message:", err)
+		return // отправитель сочтёт кадр потерянным по таймауту
+	}
+
+	t.mu.Lock()
+	f := t.frames[ref]
+	delete(t.frames, ref)
+	t.stats.Decoded++
+	t.stats.DecodeTime += decode
+	t.mu.Unlock()
+	if f == nil {
+		return // кадр опоздал и уже доставлен как потерянный
+	}
+
+	msg.Attach(f.orig)
+	n.Deliver(msg)
+	close(f.done)
+}
+
+// lose delivers the frame ref as lost. If the frame has just reached the
+// receiver, it waits for that delivery instead.
+func (t *Transport) lose(ref uint64, receiver *node.Node, f *frame) {
+	t.mu.Lock()
+	_, inFlight := t.frames[ref]
+	delete(t.frames, ref)
+	t.mu.Unlock()
+	if !inFlight {
+		<-f.done
+		return
+	}
+	t.deliverLost(receiver, f.orig)
+}
+
+func (t *Transport) deliverLost(receiver *node.Node, msg node.Message) {
+	msg.Status = node.Lost
+	receiver.Deliver(msg)
+}
@@ -0,0 +1,451 @@
+package topology
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Edge is an edge of a topology file with its optional link properties;
+// a negative Latency or Loss keeps the link of the configured link model.
+type Edge struct {
+	From, To int
+	Latency  float64 // средняя задержка в миллисекундах
+	Loss     float64
+}
+
+// Load reads a topology file: GraphViz DOT (.dot, .gv), GraphML (.graphml,
+// .xml) or an edge list (anything else). Edges are undirected. Edge
+// attributes latency (or delay) in ms and loss set the properties of the
+// link; an edge listed in both directions can have different properties
+// in each.
+//
+// If every node name is an integer, the names are the node IDs; otherwise the
+// nodes are numbered in the order they appear. Either way the file must
+// describe exactly nodeCount nodes.
+func Load(path string, nodeCount int) (*Graph, error) {
+	var f *file
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dot", ".gv":
+		f, err = readDOT(path)
+	case ".graphml", ".xml":
+		f, err = readGraphML(path)
+	default:
+		f, err = readEdgeList(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("topology file %s: %w", path, err)
+	}
+	g, err := f.graph(nodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("topology file %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// file is a topology as read, with the node names of the file.
+type file struct {
+	nodes []string // в порядке появления
+	index map[string]bool
+	edges []namedEdge
+}
+
+type namedEdge struct {
+	from, to      string
+	latency, loss float64
+}
+
+func newFile() *file {
+	return &file{index: make(map[string]bool)}
+}
+
+func (f *file) node(name string) {
+	if !f.index[name] {
+		f.index[name] = true
+		f.nodes = append(f.nodes, name)
+	}
+}
+
+func (f *file) edge(from, to string, attrs map[string]string) error {
+	f.node(from)
+	f.node(to)
+	e := namedEdge{from: from, to: to, latency: -1, loss: -1}
+	for k, v := range attrs {
+		var target *float64
+		switch strings.ToLower(k) {
+		case "latency", "delay":
+			target = &e.latency
+		case "loss":
+			target = &e.loss
+		default:
+			continue // остальные атрибуты (label, weight, ...) не нужны
+		}
+		x, err := strconv.ParseFloat(v, 64)
+		if err != nil || x < 0 {
+			return fmt.Errorf("edge %s-%s: invalid %s %q", from, to, k, v)
+		}
+		*target = x
+	}
+	if e.loss > 1 {
+		return fmt.Errorf("edge %s-%s: loss %v is not a probability", from, to, e.loss)
+	}
+	f.edges = append(f.edges, e)
+	return nil
+}
+
+// graph numbers the nodes and checks their count against nodeCount.
+func (f *file) graph(nodeCount int) (*Graph, error) {
+	ids := make(map[string]int, len(f.nodes))
+	numeric := true
+	count := 0
+	for _, name := range f.nodes {
+		id, err := strconv.Atoi(name)
+		if err != nil || id < 0 {
+			numeric = false
+			break
+		}
+		ids[name] = id
+		count = max(count, id+1)
+	}
+	if !numeric {
+		count = len(f.nodes)
+		for i, name := range f.nodes {
+			ids[name] = i
+		}
+	}
+	if count != nodeCount {
+		return nil, fmt.Errorf("the file has %d nodes, but -nodes is %d", count, nodeCount)
+	}
+
+	b := newBuilder(nodeCount)
+	g := &Graph{Name: "file"}
+	set := make(map[[2]int]bool)
+	for _, e := range f.edges {
+		from, to := ids[e.from], ids[e.to]
+		b.add(from, to)
+		if e.latency < 0 && e.loss < 0 {
+			continue
+		}
+		// как и в файле каналов, ребро задаёт оба направления, пока обратное не указано явно
+		g.Links = append(g.Links, Edge{From: from, To: to, Latency: e.latency, Loss: e.loss})
+		set[[2]int{from, to}] = true
+	}
+	for _, e := range g.Links {
+		if !set[[2]int{e.To, e.From}] {
+			g.Links = append(g.Links, Edge{From: e.To, To: e.From, Latency: e.Latency, Loss: e.Loss})
+			set[[2]int{e.To, e.From}] = true
+		}
+	}
+	g.Adj = b.graph(g.Name).Adj
+	return g, nil
+}
+
+// readEdgeList reads lines "from to [latency [loss]]" separated by spaces or
+// commas. A line with a single name declares an isolated node, # starts a
+// comment and the first line that is not blank or a comment may be a header.
+func readEdgeList(path string) (*file, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	f := newFile()
+	scanner := bufio.NewScanner(fh)
+	line := 0
+	first := true // заголовок может идти только первой непустой строкой
+	for scanner.Scan() {
+		line++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if strings.Contains(text, ",") {
+			// в CSV пустое поле оставляет свойство канала по умолчанию
+			fields = strings.Split(text, ",")
+			for i := range fields {
+				fields[i] = strings.TrimSpace(fields[i])
+			}
+		}
+		if len(fields) == 0 || fields[0] == "" {
+			continue
+		}
+		if first {
+			first = false
+			if isHeader(fields) {
+				continue
+			}
+		}
+		if len(fields) == 1 {
+			f.node(fields[0])
+			continue
+		}
+		attrs := make(map[string]string)
+		if len(fields) > 2 && fields[2] != "" {
+			attrs["latency"] = fields[2]
+		}
+		if len(fields) > 3 && fields[3] != "" {
+			attrs["loss"] = fields[3]
+		}
+		if err := f.edge(fields[0], fields[1], attrs); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return f, scanner.Err()
+}
+
+func isHeader(fields []string) bool {
+	switch strings.ToLower(fields[0]) {
+	case "from", "source", "src", "u", "node1":
+		return true
+	}
+	return false
+}
+
+// readDOT reads the node and edge statements of a GraphViz graph or digraph.
+// Attributes of edge statements and of "edge [...]" defaults are used;
+// subgraph braces are flattened.
+func readDOT(path string) (*file, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := dotTokens(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	f := newFile()
+	defaults := make(map[string]string) // атрибуты из edge [...]
+	i := 0
+	// пропускаем заголовок [strict] (graph|digraph) [имя] {
+	for i < len(tokens) && tokens[i] != "{" {
+		i++
+	}
+	i++
+	for i < len(tokens) {
+		switch tok := tokens[i]; {
+		case tok == "{" || tok == "}" || tok == ";" || tok == ",":
+			i++
+			continue
+		case tok == "subgraph":
+			i++
+			if i < len(tokens) && tokens[i] != "{" {
+				i++ // имя подграфа
+			}
+			continue
+		}
+
+		// список узлов, соединённых -- или ->
+		chain := []string{tokens[i]}
+		i++
+		for i+1 < len(tokens) && (tokens[i] == "--" || tokens[i] == "->") {
+			chain = append(chain, tokens[i+1])
+			i += 2
+		}
+		attrs := make(map[string]string)
+		if i < len(tokens) && tokens[i] == "[" {
+			i, err = dotAttrs(tokens, i, attrs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if i < len(tokens) && tokens[i] == "=" {
+			i += 2 // присваивание атрибута графа: rankdir=LR
+			continue
+		}
+
+		switch head := chain[0]; {
+		case len(chain) > 1:
+			merged := make(map[string]string, len(defaults)+len(attrs))
+			for k, v := range defaults {
+				merged[k] = v
+			}
+			for k, v := range attrs {
+				merged[k] = v
+			}
+			for j := 1; j < len(chain); j++ {
+				if err := f.edge(chain[j-1], chain[j], merged); err != nil {
+					return nil, err
+				}
+			}
+		case head == "edge":
+			for k, v := range attrs {
+				defaults[k] = v
+			}
+		case head == "graph" || head == "node":
+			// атрибуты по умолчанию для графа и узлов не нужны
+		default:
+			f.node(head)
+		}
+	}
+	return f, nil
+}
+
+// dotAttrs reads an attribute list starting at tokens[i] == "[" and returns
+// the index after its closing bracket.
+func dotAttrs(tokens []string, i int, attrs map[string]string) (int, error) {
+	i++
+	for i < len(tokens) && tokens[i] != "]" {
+		if tokens[i] == "," || tokens[i] == ";" {
+			i++
+			continue
+		}
+		if i+2 >= len(tokens) || tokens[i+1] != "=" {
+			return 0, fmt.Errorf("malformed attribute list near %q", tokens[i])
+		}
+		attrs[tokens[i]] = tokens[i+2]
+		i += 3
+	}
+	if i >= len(tokens) {
+		return 0, fmt.Errorf("unterminated attribute list")
+	}
+	return i + 1, nil
+}
+
+// dotTokens splits DOT source into IDs, quoted strings (without quotes) and
+// punctuation, dropping comments.
+func dotTokens(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		rest := src[i:]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 2
+		case c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, sb.String())
+			i = j + 1
+		case strings.HasPrefix(rest, "--") || strings.HasPrefix(rest, "->"):
+			tokens = append(tokens, rest[:2])
+			i += 2
+		case strings.IndexByte("{}[];,=", c) >= 0:
+			tokens = append(tokens, rest[:1])
+			i++
+		default:
+			j := i
+			for j < len(src) && isIDByte(src, j) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// isIDByte reports whether src[i] continues a DOT ID: letters, digits, '_',
+// '.', non-ASCII bytes and a '-' that does not start an edge operator.
+func isIDByte(src string, i int) bool {
+	c := src[i]
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.', c >= 0x80:
+		return true
+	case c == '-':
+		return !strings.HasPrefix(src[i:], "--") && !strings.HasPrefix(src[i:], "->")
+	}
+	return false
+}
+
+// graphML is the part of a GraphML document the loader reads.
+type graphML struct {
+	Keys []struct {
+		ID      string `xml:"id,attr"`
+		For     string `xml:"for,attr"`
+		Name    string `xml:"attr.name,attr"`
+		Default string `xml:"default"`
+	} `xml:"key"`
+	Graphs []struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"data"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// readGraphML reads the nodes and edges of the graphs of a GraphML document.
+// Edge data is matched to the attribute names of the <key> declarations.
+func readGraphML(path string) (*file, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc graphML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)    // id ключа -> имя атрибута
+	defaults := make(map[string]string) // значения ключей по умолчанию
+	for _, k := range doc.Keys {
+		if k.For != "edge" && k.For != "all" {
+			continue
+		}
+		name := k.Name
+		if name == "" {
+			name = k.ID
+		}
+		names[k.ID] = name
+		if d := strings.TrimSpace(k.Default); d != "" {
+			defaults[name] = d
+		}
+	}
+
+	f := newFile()
+	for _, g := range doc.Graphs {
+		for _, n := range g.Nodes {
+			f.node(n.ID)
+		}
+		for _, e := range g.Edges {
+			attrs := make(map[string]string, len(defaults))
+			for k, v := range defaults {
+				attrs[k] = v
+			}
+			for _, d := range e.Data {
+				if name, ok := names[d.Key]; ok {
+					attrs[name] = strings.TrimSpace(d.Value)
+				}
+			}
+			if err := f.edge(e.Source, e.Target, attrs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,207 @@
+package topology
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTopology writes content to a file with the given name in a temporary
+// directory and returns its path.
+func writeTopology(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// linkSet indexes the links of g by direction.
+func linkSet(g *Graph) map[[2]int]Edge {
+	set := make(map[[2]int]Edge, len(g.Links))
+	for _, e := range g.Links {
+		set[[2]int{e.From, e.To}] = e
+	}
+	return set
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		nodes   int
+		adj     [][]int
+		links   map[[2]int]Edge
+		wantErr string
+	}{
+		{
+			name:    "edge list with spaces",
+			file:    "g.txt",
+			content: "0 1\n1 2\n2 0\n",
+			nodes:   3,
+			adj:     [][]int{{1, 2}, {0, 2}, {0, 1}},
+			links:   map[[2]int]Edge{},
+		},
+		{
+			name:    "header after comments and blank lines",
+			file:    "g.csv",
+			content: "# ring\n\nfrom,to,latency,loss\n0,1,5,\n1,2,,0.25\n",
+			nodes:   3,
+			adj:     [][]int{{1}, {0, 2}, {1}},
+			links: map[[2]int]Edge{
+				{0, 1}: {From: 0, To: 1, Latency: 5, Loss: -1},
+				{1, 0}: {From: 1, To: 0, Latency: 5, Loss: -1},
+				{1, 2}: {From: 1, To: 2, Latency: -1, Loss: 0.25},
+				{2, 1}: {From: 2, To: 1, Latency: -1, Loss: 0.25},
+			},
+		},
+		{
+			name:    "header only on the first line",
+			file:    "g.txt",
+			content: "0 1\nfrom to\n",
+			nodes:   2,
+			wantErr: "the file has 4 nodes, but -nodes is 2",
+		},
+		{
+			name:    "both directions keep their own latency",
+			file:    "g.txt",
+			content: "0 1 5\n1 0 7\n",
+			nodes:   2,
+			adj:     [][]int{{1}, {0}},
+			links: map[[2]int]Edge{
+				{0, 1}: {From: 0, To: 1, Latency: 5, Loss: -1},
+				{1, 0}: {From: 1, To: 0, Latency: 7, Loss: -1},
+			},
+		},
+		{
+			name:    "named nodes and an isolated node",
+			file:    "g.txt",
+			content: "a b\nb c\nd\n",
+			nodes:   4,
+			adj:     [][]int{{1}, {0, 2}, {1}, {}},
+			links:   map[[2]int]Edge{},
+		},
+		{
+			name:    "edge list node count mismatch",
+			file:    "g.txt",
+			content: "0 1\n1 2\n",
+			nodes:   4,
+			wantErr: "the file has 3 nodes, but -nodes is 4",
+		},
+		{
+			name:    "loss above one",
+			file:    "g.txt",
+			content: "0 1 5 1.5\n",
+			nodes:   2,
+			wantErr: "not a probability",
+		},
+		{
+			name: "DOT with edge defaults and attributes",
+			file: "g.dot",
+			content: `graph g {
+	// узлы нумеруются по порядку появления
+	rankdir=LR;
+	a -- b -- c [latency=5];
+	edge [loss=0.1];
+	c -- a;
+	d;
+}`,
+			nodes: 4,
+			adj:   [][]int{{1, 2}, {0, 2}, {0, 1}, {}},
+			links: map[[2]int]Edge{
+				{0, 1}: {From: 0, To: 1, Latency: 5, Loss: -1},
+				{1, 0}: {From: 1, To: 0, Latency: 5, Loss: -1},
+				{1, 2}: {From: 1, To: 2, Latency: 5, Loss: -1},
+				{2, 1}: {From: 2, To: 1, Latency: 5, Loss: -1},
+				{2, 0}: {From: 2, To: 0, Latency: -1, Loss: 0.1},
+				{0, 2}: {From: 0, To: 2, Latency: -1, Loss: 0.1},
+			},
+		},
+		{
+			name:    "DOT digraph with quoted IDs and subgraph",
+			file:    "g.gv",
+			content: "digraph { subgraph s { \"0\" -> \"1\" [delay=\"2.5\", label=x] } 1 -> 2 }",
+			nodes:   3,
+			adj:     [][]int{{1}, {0, 2}, {1}},
+			links: map[[2]int]Edge{
+				{0, 1}: {From: 0, To: 1, Latency: 2.5, Loss: -1},
+				{1, 0}: {From: 1, To: 0, Latency: 2.5, Loss: -1},
+			},
+		},
+		{
+			name:    "DOT node count mismatch",
+			file:    "g.dot",
+			content: "graph { 0 -- 1 }",
+			nodes:   3,
+			wantErr: "the file has 2 nodes, but -nodes is 3",
+		},
+		{
+			name:    "DOT unterminated attribute list",
+			file:    "g.dot",
+			content: "graph { 0 -- 1 [latency=5 }",
+			nodes:   2,
+			wantErr: "attribute list",
+		},
+		{
+			name: "GraphML with key defaults",
+			file: "g.graphml",
+			content: `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="d0" for="edge" attr.name="latency" attr.type="double"><default>3</default></key>
+  <key id="d1" for="edge" attr.name="loss" attr.type="double"/>
+  <key id="d2" for="node" attr.name="latency" attr.type="double"/>
+  <graph edgedefault="undirected">
+    <node id="n0"/><node id="n1"/><node id="n2"/>
+    <edge source="n0" target="n1"/>
+    <edge source="n1" target="n2"><data key="d0">8</data><data key="d1">0.5</data></edge>
+  </graph>
+</graphml>`,
+			nodes: 3,
+			adj:   [][]int{{1}, {0, 2}, {1}},
+			links: map[[2]int]Edge{
+				{0, 1}: {From: 0, To: 1, Latency: 3, Loss: -1},
+				{1, 0}: {From: 1, To: 0, Latency: 3, Loss: -1},
+				{1, 2}: {From: 1, To: 2, Latency: 8, Loss: 0.5},
+				{2, 1}: {From: 2, To: 1, Latency: 8, Loss: 0.5},
+			},
+		},
+		{
+			name: "GraphML node count mismatch",
+			file: "g.xml",
+			content: `<graphml><graph>
+  <node id="0"/><node id="1"/><node id="2"/>
+  <edge source="0" target="1"/>
+</graph></graphml>`,
+			nodes:   2,
+			wantErr: "the file has 3 nodes, but -nodes is 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := Load(writeTopology(t, tt.file, tt.content), tt.nodes)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			adj := make([][]int, len(g.Adj))
+			for i, peers := range g.Adj {
+				adj[i] = append([]int{}, peers...)
+			}
+			if !reflect.DeepEqual(adj, tt.adj) {
+				t.Errorf("Adj = %v, want %v", adj, tt.adj)
+			}
+			if links := linkSet(g); !reflect.DeepEqual(links, tt.links) {
+				t.Errorf("Links = %v, want %v", links, tt.links)
+			}
+		})
+	}
+}
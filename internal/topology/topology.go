@@ -0,0 +1,338 @@
+// Package topology builds the overlay graph the nodes communicate over: who
+// is in the Peers slice of whom.
+//
+// The complete graph (everyone knows everyone) is the default. The other
+// generators build undirected graphs without self-loops; the random ones draw
+// from their own stream, so every simulation of an experiment runs on the same
+// graph.
+package topology
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+)
+
+// Supported topologies.
+const (
+	Complete       = "complete"
+	Ring           = "ring"
+	Line           = "line"
+	Star           = "star"
+	Grid           = "grid"
+	Torus          = "torus"
+	Regular        = "regular"         // случайный k-регулярный граф
+	ErdosRenyi     = "erdos-renyi"     // каждое ребро с вероятностью p
+	BarabasiAlbert = "barabasi-albert" // предпочтительное присоединение, m рёбер на узел
+	WattsStrogatz  = "watts-strogatz"  // кольцо степени k с перестановкой рёбер с вероятностью beta
+)
+
+// Graph is the overlay of one experiment. Adj[i] lists the neighbours of
+// node i in increasing order.
+type Graph struct {
+	Name  string
+	Adj   [][]int
+	Links []Edge // направленные каналы со свойствами из файла топологии
+}
+
+// Build generates the topology of the experiment or loads it from
+// -topology-file. The complete graph is returned as nil: nodes keep the
+// Peers NewCluster gives them.
+func Build(exper flags.Experiment) (*Graph, error) {
+	n := exper.NodeCount
+	if exper.TopologyFile != "" {
+		return Load(exper.TopologyFile, n)
+	}
+	k := exper.TopologyDegree
+	p := exper.TopologyProb
+	rs := rng.New(exper.Seed, "topology")
+
+	var b *builder
+	var err error
+	switch exper.Topology {
+	case Complete, "":
+		return nil, nil
+	case Ring:
+		b = ring(n)
+	case Line:
+		b = line(n)
+	case Star:
+		b = star(n)
+	case Grid:
+		b = grid(n, false)
+	case Torus:
+		b = grid(n, true)
+	case Regular:
+		b, err = regular(n, k, rs)
+	case ErdosRenyi:
+		b, err = erdosRenyi(n, p, rs)
+	case BarabasiAlbert:
+		b, err = barabasiAlbert(n, k, rs)
+	case WattsStrogatz:
+		b, err = wattsStrogatz(n, k, p, rs)
+	default:
+		return nil, fmt.Errorf("unknown topology %q", exper.Topology)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s topology: %w", exper.Topology, err)
+	}
+	return b.graph(exper.Topology), nil
+}
+
+// Apply sets the Peers of every node from the graph; a nil graph leaves the
+// complete graph of NewCluster.
+func Apply(nodes []*node.Node, g *Graph) {
+	if g == nil {
+		return
+	}
+	for i, n := range nodes {
+		n.Peers = make([]*node.Node, 0, len(g.Adj[i]))
+		for _, j := range g.Adj[i] {
+			n.Peers = append(n.Peers, nodes[j])
+		}
+	}
+}
+
+// Edges returns the number of undirected edges of the graph.
+func (g *Graph) Edges() int {
+	total := 0
+	for _, adj := range g.Adj {
+		total += len(adj)
+	}
+	return total / 2
+}
+
+// builder collects the edges of an undirected simple graph.
+type builder struct {
+	adj []map[int]bool
+}
+
+func newBuilder(n int) *builder {
+	b := &builder{adj: make([]map[int]bool, n)}
+	for i := range b.adj {
+		b.adj[i] = make(map[int]bool)
+	}
+	return b
+}
+
+// add links i and j; self-loops and repeated edges are ignored.
+func (b *builder) add(i, j int) bool {
+	if i == j || b.adj[i][j] {
+		return false
+	}
+	b.adj[i][j] = true
+	b.adj[j][i] = true
+	return true
+}
+
+func (b *builder) remove(i, j int) {
+	delete(b.adj[i], j)
+	delete(b.adj[j], i)
+}
+
+func (b *builder) has(i, j int) bool {
+	return b.adj[i][j]
+}
+
+// edges lists every edge once, in a fixed order.
+func (b *builder) edges() [][2]int {
+	var es [][2]int
+	for i := range b.adj {
+		for _, j := range sortedKeys(b.adj[i]) {
+			if i < j {
+				es = append(es, [2]int{i, j})
+			}
+		}
+	}
+	return es
+}
+
+func (b *builder) graph(name string) *Graph {
+	g := &Graph{Name: name, Adj: make([][]int, len(b.adj))}
+	for i, set := range b.adj {
+		g.Adj[i] = sortedKeys(set)
+	}
+	return g
+}
+
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func ring(n int) *builder {
+	b := line(n)
+	if n > 2 {
+		b.add(n-1, 0)
+	}
+	return b
+}
+
+func line(n int) *builder {
+	b := newBuilder(n)
+	for i := 1; i < n; i++ {
+		b.add(i-1, i)
+	}
+	return b
+}
+
+func star(n int) *builder {
+	b := newBuilder(n)
+	for i := 1; i < n; i++ {
+		b.add(0, i)
+	}
+	return b
+}
+
+// grid lays the nodes out row by row on the most square rows x cols grid with
+// rows*cols = n; a torus also links the opposite borders.
+func grid(n int, wrap bool) *builder {
+	rows := 1
+	for r := int(math.Sqrt(float64(n))); r >= 1; r-- {
+		if n%r == 0 {
+			rows = r
+			break
+		}
+	}
+	cols := n / rows
+	b := newBuilder(n)
+	for r := range rows {
+		for c := range cols {
+			id := r*cols + c
+			if c+1 < cols {
+				b.add(id, id+1)
+			} else if wrap && cols > 2 {
+				b.add(id, r*cols)
+			}
+			if r+1 < rows {
+				b.add(id, id+cols)
+			} else if wrap && rows > 2 {
+				b.add(id, c)
+			}
+		}
+	}
+	return b
+}
+
+// lattice links every node to its k nearest neighbours on a ring (k/2 on each
+// side); with an odd k each node is also linked to the node opposite to it.
+func lattice(n, k int) (*builder, error) {
+	if k < 1 || k >= n {
+		return nil, fmt.Errorf("degree must be between 1 and %d, got %d", n-1, k)
+	}
+	if k%2 == 1 && n%2 == 1 {
+		return nil, fmt.Errorf("an odd degree %d needs an even number of nodes", k)
+	}
+	b := newBuilder(n)
+	for i := range n {
+		for j := 1; j <= k/2; j++ {
+			b.add(i, (i+j)%n)
+		}
+		if k%2 == 1 {
+			b.add(i, (i+n/2)%n)
+		}
+	}
+	return b, nil
+}
+
+// regular starts from a ring lattice and randomizes it with degree-preserving
+// edge swaps, so every node keeps exactly k neighbours.
+func regular(n, k int, rs *rng.Stream) (*builder, error) {
+	b, err := lattice(n, k)
+	if err != nil {
+		return nil, err
+	}
+	es := b.edges()
+	for range 10 * len(es) {
+		x, y := rs.Intn(len(es)), rs.Intn(len(es))
+		a, c := es[x][0], es[x][1]
+		d, e := es[y][0], es[y][1]
+		// a-c, d-e становятся a-e, d-c, если это не даёт петель и кратных рёбер
+		if a == e || d == c || b.has(a, e) || b.has(d, c) || x == y {
+			continue
+		}
+		b.remove(a, c)
+		b.remove(d, e)
+		b.add(a, e)
+		b.add(d, c)
+		es[x] = [2]int{a, e}
+		es[y] = [2]int{d, c}
+	}
+	return b, nil
+}
+
+func erdosRenyi(n int, p float64, rs *rng.Stream) (*builder, error) {
+	if p < 0 || p > 1 {
+		return nil, fmt.Errorf("edge probability must be between 0 and 1, got %v", p)
+	}
+	b := newBuilder(n)
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			if rs.Float64() < p {
+				b.add(i, j)
+			}
+		}
+	}
+	return b, nil
+}
+
+// barabasiAlbert grows the graph from a clique of m+1 nodes; every new node
+// links to m distinct nodes chosen with probability proportional to their degree.
+func barabasiAlbert(n, m int, rs *rng.Stream) (*builder, error) {
+	if m < 1 || m >= n {
+		return nil, fmt.Errorf("edges per node must be between 1 and %d, got %d", n-1, m)
+	}
+	b := newBuilder(n)
+	var ends []int // каждый узел встречается столько раз, какова его степень
+	for i := 0; i <= m; i++ {
+		for j := range i {
+			b.add(i, j)
+			ends = append(ends, i, j)
+		}
+	}
+	for i := m + 1; i < n; i++ {
+		targets := make(map[int]bool)
+		for len(targets) < m {
+			targets[ends[rs.Intn(len(ends))]] = true
+		}
+		for _, t := range sortedKeys(targets) {
+			b.add(i, t)
+			ends = append(ends, i, t)
+		}
+	}
+	return b, nil
+}
+
+// wattsStrogatz rewires every edge of a ring lattice of degree k to a random
+// node with probability beta, turning the lattice into a small world.
+func wattsStrogatz(n, k int, beta float64, rs *rng.Stream) (*builder, error) {
+	if beta < 0 || beta > 1 {
+		return nil, fmt.Errorf("rewiring probability must be between 0 and 1, got %v", beta)
+	}
+	b, err := lattice(n, k)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range b.edges() {
+		if rs.Float64() >= beta || len(b.adj[e[0]]) >= n-1 {
+			continue
+		}
+		for {
+			t := rs.Intn(n)
+			if t != e[0] && !b.has(e[0], t) {
+				b.remove(e[0], e[1])
+				b.add(e[0], t)
+				break
+			}
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,142 @@
+package topology
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+)
+
+// checkSimple fails the test unless g is an undirected graph without
+// self-loops and repeated edges, with every Adj list sorted.
+func checkSimple(t *testing.T, g *Graph) {
+	t.Helper()
+	for i, peers := range g.Adj {
+		for k, j := range peers {
+			if j == i {
+				t.Errorf("node %d is linked to itself", i)
+			}
+			if k > 0 && peers[k-1] >= j {
+				t.Errorf("Adj[%d] = %v is not strictly increasing", i, peers)
+			}
+			if j < 0 || j >= len(g.Adj) {
+				t.Errorf("node %d is linked to unknown node %d", i, j)
+				continue
+			}
+			found := false
+			for _, back := range g.Adj[j] {
+				found = found || back == i
+			}
+			if !found {
+				t.Errorf("edge %d-%d has no reverse", i, j)
+			}
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		topology string
+		nodes    int
+		degree   int
+		prob     float64
+		edges    int
+		degrees  int // степень каждого узла, если не 0
+	}{
+		{name: "ring", topology: Ring, nodes: 10, edges: 10, degrees: 2},
+		{name: "ring of two", topology: Ring, nodes: 2, edges: 1, degrees: 1},
+		{name: "line", topology: Line, nodes: 10, edges: 9},
+		{name: "star", topology: Star, nodes: 10, edges: 9},
+		{name: "grid 3x4", topology: Grid, nodes: 12, edges: 17},
+		{name: "grid of a prime is a line", topology: Grid, nodes: 7, edges: 6},
+		{name: "torus 3x4", topology: Torus, nodes: 12, edges: 24, degrees: 4},
+		{name: "torus 2x2 does not wrap", topology: Torus, nodes: 4, edges: 4, degrees: 2},
+		{name: "torus of a prime is a ring", topology: Torus, nodes: 7, edges: 7, degrees: 2},
+		{name: "regular even degree", topology: Regular, nodes: 20, degree: 4, edges: 40, degrees: 4},
+		{name: "regular odd degree", topology: Regular, nodes: 20, degree: 3, edges: 30, degrees: 3},
+		{name: "erdos-renyi empty", topology: ErdosRenyi, nodes: 10, prob: 0, edges: 0},
+		{name: "erdos-renyi complete", topology: ErdosRenyi, nodes: 10, prob: 1, edges: 45, degrees: 9},
+		{name: "barabasi-albert", topology: BarabasiAlbert, nodes: 20, degree: 2, edges: 3 + 17*2},
+		{name: "watts-strogatz keeps the edge count", topology: WattsStrogatz, nodes: 20, degree: 4, prob: 0.5, edges: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exper := flags.Experiment{
+				NodeCount:      tt.nodes,
+				Topology:       tt.topology,
+				TopologyDegree: tt.degree,
+				TopologyProb:   tt.prob,
+				Seed:           42,
+			}
+			g, err := Build(exper)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if len(g.Adj) != tt.nodes {
+				t.Fatalf("graph has %d nodes, want %d", len(g.Adj), tt.nodes)
+			}
+			checkSimple(t, g)
+			if got := g.Edges(); got != tt.edges {
+				t.Errorf("Edges() = %d, want %d", got, tt.edges)
+			}
+			if tt.degrees > 0 {
+				for i, peers := range g.Adj {
+					if len(peers) != tt.degrees {
+						t.Errorf("node %d has degree %d, want %d", i, len(peers), tt.degrees)
+					}
+				}
+			}
+
+			// тот же seed даёт тот же граф
+			again, err := Build(exper)
+			if err != nil {
+				t.Fatalf("second Build() error = %v", err)
+			}
+			if !reflect.DeepEqual(g.Adj, again.Adj) {
+				t.Errorf("the same seed gave different graphs:\n%v\n%v", g.Adj, again.Adj)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		topology string
+		nodes    int
+		degree   int
+		prob     float64
+		wantErr  string
+	}{
+		{name: "regular odd degree odd nodes", topology: Regular, nodes: 9, degree: 3, wantErr: "needs an even number of nodes"},
+		{name: "watts-strogatz odd degree odd nodes", topology: WattsStrogatz, nodes: 9, degree: 3, wantErr: "needs an even number of nodes"},
+		{name: "regular degree too high", topology: Regular, nodes: 5, degree: 5, wantErr: "degree must be between 1 and 4"},
+		{name: "regular degree zero", topology: Regular, nodes: 5, degree: 0, wantErr: "degree must be between 1 and 4"},
+		{name: "erdos-renyi bad probability", topology: ErdosRenyi, nodes: 5, prob: 1.5, wantErr: "edge probability"},
+		{name: "barabasi-albert too many edges", topology: BarabasiAlbert, nodes: 5, degree: 5, wantErr: "edges per node"},
+		{name: "watts-strogatz bad probability", topology: WattsStrogatz, nodes: 6, degree: 2, prob: -0.1, wantErr: "rewiring probability"},
+		{name: "unknown", topology: "hypercube", nodes: 8, wantErr: `unknown topology "hypercube"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build(flags.Experiment{
+				NodeCount:      tt.nodes,
+				Topology:       tt.topology,
+				TopologyDegree: tt.degree,
+				TopologyProb:   tt.prob,
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Build() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildComplete(t *testing.T) {
+	g, err := Build(flags.Experiment{NodeCount: 5, Topology: Complete})
+	if err != nil || g != nil {
+		t.Fatalf("Build(complete) = %v, %v; want nil, nil", g, err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package workload writes to the key-value stores of the nodes while a
+// dissemination algorithm runs, the way clients update a configuration.
+//
+// At the start of a simulation the root node writes the first version of every
+// key. Then, every update interval, a random node that is up writes a new
+// version of a random key. Each write is recorded, so that the analysis can
+// measure how long every version took to reach all nodes.
+package workload
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Tarat0r/distributed-systems-modeling/cmd/flags"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/node"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/rng"
+	"github.com/Tarat0r/distributed-systems-modeling/internal/sim"
+)
+
+// Update is one write issued by the workload.
+type Update struct {
+	Entry node.Entry
+	At    time.Time
+}
+
+// Model describes the workload of one experiment.
+type Model struct {
+	Keys     int
+	Updates  int
+	Interval time.Duration
+	Seed     int64
+}
+
+var (
+	mu      sync.Mutex
+	model   *Model
+	current *run
+)
+
+// run is the workload of the running simulation.
+type run struct {
+	mu      sync.Mutex
+	timers  []*sim.Timer
+	issued  []Update
+	pending int // записи, которые ещё не выполнены
+	stopped bool
+}
+
+// Configure builds the workload from the experiment parameters.
+// Without -keys the nodes disseminate only the single message.
+func Configure(exper flags.Experiment) error {
+	if exper.Keys < 0 || exper.Updates < 0 {
+		return fmt.Errorf("keys and updates must not be negative")
+	}
+	if exper.Updates > 0 && exper.Keys == 0 {
+		return fmt.Errorf("updates need at least one key (-keys)")
+	}
+	if exper.Updates > 0 && exper.UpdateInterval <= 0 {
+		return fmt.Errorf("update interval must be positive")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	model = nil
+	if exper.Keys > 0 {
+		model = &Model{
+			Keys:     exper.Keys,
+			Updates:  exper.Updates,
+			Interval: time.Duration(exper.UpdateInterval * float64(time.Millisecond)),
+			Seed:     exper.Seed,
+		}
+	}
+	return nil
+}
+
+// Start writes the initial keys at the root node and schedules the updates of
+// a new simulation. Every simulation draws the same keys and times, so the
+// algorithms face the same workload.
+func Start(nodes []*node.Node) {
+	mu.Lock()
+	m := model
+	r := &run{}
+	current = r
+	mu.Unlock()
+	if m == nil || len(nodes) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range m.Keys {
+		r.write(nodes[0], key(k), "initial")
+	}
+
+	rs := rng.New(m.Seed, "updates")
+	r.pending = m.Updates
+	for i := 1; i <= m.Updates; i++ {
+		k := rs.Intn(m.Keys)
+		pick := rs.Float64() // узел выбирается среди живых в момент записи
+		r.timers = append(r.timers, sim.AfterFunc(time.Duration(i)*m.Interval, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.stopped {
+				return
+			}
+			r.pending--
+			if origin := pickAlive(nodes, pick); origin != nil {
+				r.write(origin, key(k), fmt.Sprintf("update %d", i))
+			}
+		}))
+	}
+}
+
+// Stop cancels the updates that have not been issued yet.
+func Stop() {
+	mu.Lock()
+	r := current
+	mu.Unlock()
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	for _, t := range r.timers {
+		t.Stop()
+	}
+	r.timers = nil
+	r.pending = 0
+}
+
+// Done reports whether every update of the running simulation has been issued.
+func Done() bool {
+	mu.Lock()
+	r := current
+	mu.Unlock()
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pending == 0
+}
+
+// Issued returns the writes of the last simulation in the order they were issued.
+func Issued() []Update {
+	mu.Lock()
+	r := current
+	mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Update(nil), r.issued...)
+}
+
+// write updates key at n. Must be called with r.mu held.
+func (r *run) write(n *node.Node, key, value string) {
+	e := n.Update(key, value)
+	r.issued = append(r.issued, Update{Entry: e, At: sim.Now()})
+}
+
+// pickAlive maps u in [0, 1) to one of the nodes that are up.
+func pickAlive(nodes []*node.Node, u float64) *node.Node {
+	var alive []*node.Node
+	for _, n := range nodes {
+		if n.IsAlive() {
+			alive = append(alive, n)
+		}
+	}
+	if len(alive) == 0 {
+		return nil
+	}
+	return alive[int(u*float64(len(alive)))]
+}
+
+func key(k int) string {
+	return fmt.Sprintf("key%d", k)
+}